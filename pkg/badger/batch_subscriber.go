@@ -0,0 +1,280 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// BatchSubscriberConfig represents batch subscriber configuration
+	// An empty value is valid, using JSON marshaling by default
+	BatchSubscriberConfig struct {
+		SubscriberConfig
+
+		// MaxBatchSize is the maximum number of messages in a batch
+		MaxBatchSize int
+
+		// MaxWait is the maximum time to wait for a batch to fill once the
+		// first message has been received. Messages are leased while waiting,
+		// so MaxWait should be significantly less than VisibilityTimeout.
+		MaxWait time.Duration
+	}
+
+	// BatchSubscriber represents a BadgerDB subscriber that delivers messages in batches
+	BatchSubscriber struct {
+		subscriber *Subscriber
+		config     BatchSubscriberConfig
+	}
+
+	// Batch represents a batch of messages
+	// Messages can be acked or nacked individually, or all at once using
+	// Ack and Nack. Acked messages are deleted in a single transaction once
+	// every message in the batch has been acked or nacked.
+	Batch struct {
+		Messages []*message.Message
+	}
+)
+
+// NewBatchSubscriber returns a new batch subscriber
+func NewBatchSubscriber(db *badger.DB, r Registry, c BatchSubscriberConfig) *BatchSubscriber {
+	c.setDefaults()
+
+	return &BatchSubscriber{
+		subscriber: NewSubscriber(db, r, c.SubscriberConfig),
+		config:     c,
+	}
+}
+
+// Subscribe creates a subscription to the specified topic
+func (b *BatchSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *Batch, error) {
+	return b.SubscribeWithConfig(ctx, topic, SubscriptionConfig{})
+}
+
+// SubscribeWithGroup creates a subscription to the specified topic for the specified consumer group
+func (b *BatchSubscriber) SubscribeWithGroup(ctx context.Context, topic, group string) (<-chan *Batch, error) {
+	return b.SubscribeWithConfig(ctx, topic, SubscriptionConfig{Group: group})
+}
+
+// SubscribeWithConfig creates a subscription to the specified topic using the specified config
+func (b *BatchSubscriber) SubscribeWithConfig(ctx context.Context, topic string, c SubscriptionConfig) (<-chan *Batch, error) {
+	subscription, err := b.subscriber.register(topic, c)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Batch)
+
+	b.subscriber.wg.Add(1)
+	go b.run(ctx, topic, subscription, c, ch)
+
+	return ch, nil
+}
+
+func (b *BatchSubscriber) Close() error {
+	return b.subscriber.Close()
+}
+
+// Ack acks all messages in the batch
+func (b *Batch) Ack() {
+	for _, m := range b.Messages {
+		m.Ack()
+	}
+}
+
+// Nack nacks all messages in the batch
+func (b *Batch) Nack() {
+	for _, m := range b.Messages {
+		m.Nack()
+	}
+}
+
+func (b *BatchSubscriber) run(ctx context.Context, topic string, subscription *Subscription, c SubscriptionConfig, ch chan<- *Batch) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer b.subscriber.wg.Done()
+
+	defer func() {
+		if subscription.Ephemeral {
+			b.subscriber.unregister(subscription)
+			close(ch)
+		}
+	}()
+
+	var statsAt time.Time
+	credits := make(priorityCredits)
+	receivedAt := time.Now()
+	for {
+		count, err := b.receiveBatch(ctx, topic, subscription, credits, ch)
+		if err != nil {
+			b.config.Logger.Error("failed to receive batch", err, watermill.LogFields{
+				"topic":        topic,
+				"subscription": subscription.Name,
+			})
+		}
+		if count > 0 {
+			receivedAt = time.Now()
+		}
+
+		statsAt = b.subscriber.reportStats(topic, subscription, statsAt)
+
+		if isIdle(c, receivedAt) {
+			return
+		}
+
+		select {
+		case <-time.After(b.config.ReceiveInterval):
+			continue
+		case <-b.subscriber.quit:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receiveBatch sends a batch of received messages to the channel, returning the number received
+func (b *BatchSubscriber) receiveBatch(ctx context.Context, topic string, subscription *Subscription, credits priorityCredits, ch chan<- *Batch) (count int, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rawMessages, err := b.getBatch(ctx, subscription.MessageKeyPrefix, credits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get messages: %w", err)
+	}
+	if len(rawMessages) < 1 {
+		return 0, nil
+	}
+
+	count = len(rawMessages)
+
+	b.config.Logger.Debug("got batch", watermill.LogFields{
+		"topic":        topic,
+		"subscription": subscription.Name,
+		"count":        len(rawMessages),
+	})
+
+	b.subscriber.recordReceived(topic, subscription.Name, rawMessages)
+
+	batch := &Batch{Messages: make([]*message.Message, 0, len(rawMessages))}
+	received := make([]receivedMessage, 0, len(rawMessages))
+
+	defer func() {
+		for _, r := range received {
+			if r.span != nil {
+				endSpan(r.span, err)
+			}
+		}
+	}()
+
+	for _, rawMessage := range rawMessages {
+		var r receivedMessage
+		r, err = b.subscriber.decodeMessage(ctx, topic, subscription, rawMessage)
+
+		var unmarshalErr *UnmarshalError
+		if errors.As(err, &unmarshalErr) {
+			if err = b.subscriber.quarantine(topic, subscription, rawMessage, unmarshalErr); err != nil {
+				return count, err
+			}
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		received = append(received, r)
+		batch.Messages = append(batch.Messages, r.message)
+	}
+
+	if len(received) < 1 {
+		return count, nil
+	}
+
+	select {
+	case ch <- batch:
+	case <-ctx.Done():
+		return count, ctx.Err()
+	case <-b.subscriber.quit:
+		return count, ErrSubscriberClosed
+	}
+
+	var ackKeys, refs [][]byte
+	results := make([]bool, len(received))
+
+	for i, message := range batch.Messages {
+		select {
+		case <-message.Acked():
+			ackKeys = append(ackKeys, received[i].ackKeys...)
+			refs = append(refs, received[i].refs...)
+			results[i] = true
+		case <-message.Nacked():
+		case <-ctx.Done():
+			return count, ctx.Err()
+		case <-b.subscriber.quit:
+			return count, ErrSubscriberClosed
+		}
+	}
+
+	if err = b.subscriber.ack(ackKeys, refs); err != nil {
+		return count, fmt.Errorf("failed to ack: %w", err)
+	}
+
+	for i, acked := range results {
+		b.subscriber.recordResult(topic, subscription.Name, received[i], acked)
+	}
+
+	return count, nil
+}
+
+// getBatch leases messages until either the batch is full, or MaxWait has
+// elapsed since the first message was leased
+func (b *BatchSubscriber) getBatch(ctx context.Context, prefix []byte, credits priorityCredits) ([]rawMessage, error) {
+	var messages []rawMessage
+	var deadline <-chan time.Time
+
+	for {
+		limit := min(b.config.ReceiveBatchSize, b.config.MaxBatchSize-len(messages))
+
+		leased, err := b.subscriber.getMessages(prefix, limit, credits)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, leased...)
+		if len(messages) < 1 || len(messages) >= b.config.MaxBatchSize {
+			return messages, nil
+		}
+
+		if deadline == nil {
+			deadline = time.After(b.config.MaxWait)
+		}
+
+		select {
+		case <-time.After(b.config.ReceiveInterval):
+		case <-deadline:
+			return messages, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.subscriber.quit:
+			return nil, ErrSubscriberClosed
+		}
+	}
+}
+
+func (c *BatchSubscriberConfig) setDefaults() {
+	c.SubscriberConfig.setDefaults()
+
+	if c.MaxBatchSize < 1 {
+		c.MaxBatchSize = c.ReceiveBatchSize
+	}
+
+	if c.MaxWait < 1 {
+		c.MaxWait = c.ReceiveInterval
+	}
+}
@@ -0,0 +1,172 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestBatchSubscriber_Subscribe(t *testing.T) {
+	t.Run("should return an error if the registration cannot be created", func(t *testing.T) {
+		registry := &testRegistry{
+			registerFn: func(topic, subscription string) (*badger.Subscription, error) {
+				return nil, errTest
+			},
+		}
+
+		sut := badger.NewBatchSubscriber(testDB, registry, badger.BatchSubscriberConfig{})
+		_, err := sut.Subscribe(context.Background(), "topic")
+		assertErrorExists(t, err, true)
+	})
+
+	m1, m2, m3 := newMessage("payload1"), newMessage("payload2"), newMessage("payload3")
+
+	tests := []struct {
+		name    string
+		handle  func(*badger.Batch)
+		expSize []int
+		exp     []*message.Message
+	}{
+		{
+			name:    "should deliver and ack batches",
+			handle:  func(b *badger.Batch) { b.Ack() },
+			expSize: []int{2, 1},
+		},
+		{
+			name:    "should redeliver nacked batches",
+			handle:  func(b *badger.Batch) { b.Nack() },
+			expSize: []int{2, 1},
+			exp:     []*message.Message{m1, m2, m3},
+		},
+		{
+			name: "should redeliver individually nacked messages",
+			handle: func(b *badger.Batch) {
+				for i, m := range b.Messages {
+					if i%2 == 0 {
+						m.Ack()
+					} else {
+						m.Nack()
+					}
+				}
+			},
+			expSize: []int{2, 1},
+			exp:     []*message.Message{m2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry()
+			defer r.Close()
+
+			p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+			defer p.Close()
+
+			sut := badger.NewBatchSubscriber(testDB, r, badger.BatchSubscriberConfig{
+				SubscriberConfig: badger.SubscriberConfig{
+					ReceiveInterval:   10 * time.Millisecond,
+					VisibilityTimeout: 200 * time.Millisecond,
+				},
+				MaxBatchSize: 2,
+				MaxWait:      50 * time.Millisecond,
+			})
+			defer sut.Close()
+
+			ch, err := sut.Subscribe(context.Background(), "topic")
+			if !assertNilError(t, err) {
+				return
+			}
+
+			err = p.Publish("topic", m1, m2, m3)
+			if !assertNilError(t, err) {
+				return
+			}
+
+			var received []*message.Message
+			for _, size := range tt.expSize {
+				select {
+				case b := <-ch:
+					assertEqual(t, len(b.Messages), size)
+					received = append(received, b.Messages...)
+					tt.handle(b)
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for batch")
+				}
+			}
+
+			assertMessagesEqual(t, received, []*message.Message{m1, m2, m3})
+
+			var redelivered []*message.Message
+			for len(redelivered) < len(tt.exp) {
+				select {
+				case b := <-ch:
+					redelivered = append(redelivered, b.Messages...)
+					b.Ack()
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for redelivery")
+				}
+			}
+
+			assertMessagesEqual(t, redelivered, tt.exp)
+
+			select {
+			case b := <-ch:
+				t.Errorf("got %d messages, expected none", len(b.Messages))
+				b.Ack()
+			case <-time.After(300 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestBatchSubscriber_Quarantine(t *testing.T) {
+	t.Run("should quarantine messages that cannot be unmarshaled", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewBatchSubscriber(testDB, r, badger.BatchSubscriberConfig{
+			SubscriberConfig: badger.SubscriberConfig{
+				ReceiveInterval: 10 * time.Millisecond,
+			},
+			MaxBatchSize: 2,
+			MaxWait:      50 * time.Millisecond,
+		})
+		defer sut.Close()
+
+		ch, err := sut.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		subscriptions, err := r.Subscriptions("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{Marshaler: corruptMarshaler{}}).
+			Publish("topic", newMessage("corrupt"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		exp := newMessage("payload")
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", exp)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		select {
+		case b := <-ch:
+			assertMessagesEqual(t, b.Messages, []*message.Message{exp})
+			b.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+
+		assertEqual(t, countKeys(t, subscriptions[0].QuarantineKeyPrefix), 1)
+	})
+}
@@ -0,0 +1,67 @@
+package badger
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// StorageMode represents how published messages are stored for subscriptions
+type StorageMode int
+
+const (
+	// StorageCopy writes a copy of each message for every subscription
+	// Messages that exceed the publisher inline threshold are written under
+	// a stable body key, with a small pointer record for the subscription.
+	StorageCopy StorageMode = iota
+
+	// StorageShared writes each message body once, with a small pointer
+	// record for every subscription. Bodies are deleted once every
+	// subscription has acked the message.
+	StorageShared
+)
+
+// getBody returns the shared message body for the specified reference
+// A nil body is returned if the body does not exist, which results in the
+// message being quarantined rather than blocking the subscription.
+func getBody(tx *badger.Txn, ref []byte) ([]byte, error) {
+	item, err := tx.Get(bodyKey(ref))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+// releaseBody deletes the shared body reference, and the body if no references remain
+func releaseBody(tx *badger.Txn, ref []byte) error {
+	if err := tx.Delete(ref); err != nil {
+		return err
+	}
+
+	return collectBody(tx, bodyKey(ref))
+}
+
+// collectBody deletes the shared body if no references remain
+func collectBody(tx *badger.Txn, body []byte) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	iter := tx.NewIterator(opts)
+	defer iter.Close()
+
+	prefix := append(bytes.Clone(body), '.')
+	if iter.Seek(prefix); iter.ValidForPrefix(prefix) {
+		return nil
+	}
+
+	return tx.Delete(body)
+}
+
+// bodyKey returns the shared body key for the specified reference
+func bodyKey(ref []byte) []byte {
+	return ref[:bytes.LastIndexByte(ref, '.')]
+}
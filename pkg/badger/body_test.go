@@ -0,0 +1,327 @@
+package badger_test
+
+import (
+	"context"
+	"expvar"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestPublisher_StorageShared(t *testing.T) {
+	t.Run("should delete the body once all subscriptions have acked", func(t *testing.T) {
+		prefix := uuid.NewString()
+		bodyPrefix := badger.GenerateBodyKey(prefix, "")
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		var channels []<-chan *message.Message
+		for _, name := range []string{"sub1", "sub2"} {
+			s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+				Name:            name,
+				ReceiveInterval: 10 * time.Millisecond,
+			})
+			defer s.Close()
+
+			ch, err := s.Subscribe(context.Background(), "topic")
+			if !assertNilError(t, err) {
+				return
+			}
+			channels = append(channels, ch)
+		}
+
+		sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+			Storage: badger.StorageShared,
+		})
+
+		exp := newMessage("payload")
+		if err := sut.Publish("topic", exp); !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, bodyPrefix), 3) // body and two references
+
+		assertMessageReceived(t, channels[0], time.Second, exp, true)
+		waitForKeys(t, bodyPrefix, 2)
+
+		assertMessageReceived(t, channels[1], time.Second, exp, true)
+		waitForKeys(t, bodyPrefix, 0)
+	})
+
+	t.Run("should write separate bodies for topic pattern subscriptions", func(t *testing.T) {
+		prefix := uuid.NewString()
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond})
+		defer s.Close()
+
+		ch, err := s.Subscribe(context.Background(), "topic.*")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		for _, name := range []string{"sub1", "sub2"} {
+			if _, err = r.Register("topic.a", name); !assertNilError(t, err) {
+				return
+			}
+		}
+
+		m := newMessage("payload")
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{
+			Storage: badger.StorageShared,
+		}).Publish("topic.a", m)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, badger.GenerateBodyKey(prefix, "")), 5) // two bodies and three references
+
+		exp := newMessage("payload", badger.TopicKey, "topic.a")
+		exp.UUID = m.UUID
+		assertMessageReceived(t, ch, time.Second, exp, true)
+	})
+
+	t.Run("should delete the body when the message is cancelled", func(t *testing.T) {
+		prefix := uuid.NewString()
+		bodyPrefix := badger.GenerateBodyKey(prefix, "")
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		for _, name := range []string{"sub1", "sub2"} {
+			if _, err := r.Register("topic", name); !assertNilError(t, err) {
+				return
+			}
+		}
+
+		sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+			Storage: badger.StorageShared,
+		})
+
+		m := newDelayedMessage("payload", time.Hour)
+		if err := sut.Publish("topic", m); !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, bodyPrefix), 3)
+
+		if err := sut.Cancel("topic", m.UUID); !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, bodyPrefix), 0)
+	})
+
+	t.Run("should delete the body when the ephemeral subscription is deleted", func(t *testing.T) {
+		prefix := uuid.NewString()
+		bodyPrefix := badger.GenerateBodyKey(prefix, "")
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		if _, err := r.RegisterWithConfig("topic", "sub", badger.SubscriptionConfig{Ephemeral: true}); !assertNilError(t, err) {
+			return
+		}
+
+		err := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+			Storage: badger.StorageShared,
+		}).Publish("topic", newMessage("payload"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, bodyPrefix), 2)
+
+		if err = r.Unregister("topic", "sub"); !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, bodyPrefix), 0)
+	})
+}
+
+func TestPublisher_InlineThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		payload   string
+		exp       int
+	}{
+		{
+			name:    "should store small messages inline",
+			payload: "payload",
+			exp:     0,
+		},
+		{
+			name:    "should store large messages under a body key",
+			payload: strings.Repeat("a", 2<<10),
+			exp:     4, // body and reference for each subscription
+		},
+		{
+			name:      "should store all messages inline if the threshold is negative",
+			threshold: -1,
+			payload:   strings.Repeat("a", 2<<10),
+			exp:       0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := uuid.NewString()
+			bodyPrefix := badger.GenerateBodyKey(prefix, "")
+
+			r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+			defer r.Close()
+
+			var channels []<-chan *message.Message
+			for _, name := range []string{"sub1", "sub2"} {
+				s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+					Name:            name,
+					ReceiveInterval: 10 * time.Millisecond,
+				})
+				defer s.Close()
+
+				ch, err := s.Subscribe(context.Background(), "topic")
+				if !assertNilError(t, err) {
+					return
+				}
+				channels = append(channels, ch)
+			}
+
+			sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+				InlineThreshold: tt.threshold,
+			})
+
+			exp := newMessage(tt.payload)
+			if err := sut.Publish("topic", exp); !assertNilError(t, err) {
+				return
+			}
+
+			assertEqual(t, countKeys(t, bodyPrefix), tt.exp)
+
+			for _, ch := range channels {
+				assertMessageReceived(t, ch, time.Second, exp, true)
+			}
+
+			waitForKeys(t, bodyPrefix, 0)
+		})
+	}
+}
+
+func BenchmarkSubscriber_Lease(b *testing.B) {
+	for _, size := range []int{100, 1 << 10, 10 << 10, 100 << 10, 1 << 20} {
+		for _, bc := range []struct {
+			name      string
+			threshold int
+		}{
+			{name: "inline", threshold: -1},
+			{name: "body"},
+		} {
+			b.Run(strconv.Itoa(size)+"/"+bc.name, func(b *testing.B) {
+				benchmarkLease(b, size, bc.threshold)
+			})
+		}
+	}
+}
+
+// benchmarkLease repeatedly leases and nacks a single message, reporting the bytes written per lease
+func benchmarkLease(b *testing.B, size, threshold int) {
+	r := newRegistry()
+	defer r.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval:   time.Microsecond,
+		VisibilityTimeout: time.Nanosecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{InlineThreshold: threshold})
+	if err = p.Publish("topic", newMessage(strings.Repeat("a", size))); err != nil {
+		b.Fatal(err)
+	}
+
+	// the first lease writes the message, so is excluded
+	(<-ch).Nack()
+
+	vlog, user := expvarInt("badger_write_bytes_vlog"), expvarInt("badger_write_bytes_user")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		(<-ch).Nack()
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(expvarInt("badger_write_bytes_vlog")-vlog)/float64(b.N), "vlog-B/op")
+	b.ReportMetric(float64(expvarInt("badger_write_bytes_user")-user)/float64(b.N), "user-B/op")
+}
+
+func expvarInt(name string) int64 {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestJanitor_CollectBodies(t *testing.T) {
+	prefix := uuid.NewString()
+	bodyPrefix := badger.GenerateBodyKey(prefix, "")
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	if _, err := r.Register("topic", "sub"); !assertNilError(t, err) {
+		return
+	}
+
+	err := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+		Storage: badger.StorageShared,
+	}).Publish("topic", newMessage("payload"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = testDB.Update(func(tx *badgerdb.Txn) error {
+		return tx.Set(badger.GenerateBodyKey(prefix, "orphan"), []byte("payload"))
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	sut := badger.NewJanitor(testDB, r, badger.JanitorConfig{Prefix: prefix, Interval: time.Hour})
+	defer sut.Close()
+
+	waitForKeys(t, bodyPrefix, 2)
+
+	count, err := sut.CollectBodies()
+	if !assertNilError(t, err) {
+		return
+	}
+
+	assertEqual(t, count, 0)
+}
+
+func waitForKeys(t *testing.T, prefix []byte, exp int) {
+	t.Helper()
+
+	for start := time.Now(); countKeys(t, prefix) != exp; {
+		if time.Since(start) > time.Second {
+			t.Fatalf("timeout waiting for %d keys", exp)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,123 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// BulkPublisher represents a BadgerDB Watermill publisher for large numbers of messages
+	// Messages are split across as many transactions as required to respect
+	// Badger transaction size limits. Each message is written to all topic
+	// subscriptions atomically, and messages are written in order. The publish
+	// as a whole is not atomic; if an error occurs then the messages preceding
+	// PartialPublishError.Published will have been published.
+	BulkPublisher struct {
+		db       *badger.DB
+		registry Registry
+		config   PublisherConfig
+	}
+
+	// PartialPublishError is returned by BulkPublisher if an error occurs after
+	// some messages have been published
+	PartialPublishError struct {
+		Published int
+		Err       error
+	}
+)
+
+// NewBulkPublisher returns a new bulk publisher using the specified Badger DB
+func NewBulkPublisher(db *badger.DB, r Registry, c PublisherConfig) BulkPublisher {
+	c.setDefaults()
+
+	return BulkPublisher{
+		db:       db,
+		registry: r,
+		config:   c,
+	}
+}
+
+// Publish publishes the specified messages
+func (p BulkPublisher) Publish(topic string, messages ...*message.Message) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+
+	start := time.Now()
+	published, limit := 0, len(messages)
+
+	for published < len(messages) {
+		batch := messages[published:min(published+limit, len(messages))]
+
+		var n int
+		err := retry(p.config.Retry, func() (err error) {
+			n, err = p.publishBatch(topic, batch)
+			return err
+		})
+		if err != nil {
+			if published > 0 {
+				p.config.Metrics.MessagesPublished(topic, published, time.Since(start))
+				return &PartialPublishError{Published: published, Err: err}
+			}
+			return err
+		}
+
+		// the transaction limit is carried forward so that subsequent
+		// batches are not marshaled and written twice to discover it
+		published += n
+		limit = n
+	}
+
+	p.config.Metrics.MessagesPublished(topic, len(messages), time.Since(start))
+	return nil
+}
+
+func (p BulkPublisher) Close() error {
+	return nil
+}
+
+// publishBatch publishes as many messages as possible in a single transaction
+// and returns the number of messages that were published
+func (p BulkPublisher) publishBatch(topic string, messages []*message.Message) (int, error) {
+	tx := p.db.NewTransaction(true)
+	defer tx.Discard()
+
+	publisher := NewTxPublisher(tx, p.registry, p.config)
+
+	for i, m := range messages {
+		err := publisher.Publish(topic, m)
+		if err == nil {
+			continue
+		}
+
+		var tooBig *TxnTooBigError
+		if !errors.As(err, &tooBig) || i < 1 {
+			return 0, err
+		}
+
+		// the message may have been written to some subscriptions, so
+		// the preceding messages must be written in a new transaction
+		tx.Discard()
+		return p.publishBatch(topic, messages[:i])
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(messages), nil
+}
+
+// Error returns the error message
+func (e *PartialPublishError) Error() string {
+	return fmt.Sprintf("published %d messages: %v", e.Published, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PartialPublishError) Unwrap() error {
+	return e.Err
+}
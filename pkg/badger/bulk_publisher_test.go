@@ -0,0 +1,132 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestBulkPublisher_Publish(t *testing.T) {
+	testPublisher_Publish(
+		t,
+		func(r badger.Registry) (message.Publisher, func(), func() error) {
+			return badger.NewBulkPublisher(testDB, r, badger.PublisherConfig{}),
+				func() {},
+				func() error { return nil }
+		},
+	)
+
+	// a small memtable size reduces the transaction size limits
+	db, err := badgerdb.Open(badgerdb.DefaultOptions("").WithInMemory(true).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	t.Run("should split large publishes across transactions", func(t *testing.T) {
+		r := badger.NewRegistry(db, badger.RegistryConfig{})
+		defer r.Close()
+
+		s1 := badger.NewSubscriber(db, r, badger.SubscriberConfig{Name: "s1", ReceiveInterval: 10 * time.Millisecond})
+		defer s1.Close()
+
+		ch, err := s1.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		_, err = r.Register("topic", "s2")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		messages := newLargeMessages(300, 512)
+
+		var tooBig *badger.TxnTooBigError
+		err = badger.NewPublisher(db, r, badger.PublisherConfig{}).Publish("topic", messages...)
+		if !errors.As(err, &tooBig) || !errors.Is(err, badgerdb.ErrTxnTooBig) {
+			t.Fatalf("got %v, expected %T", err, tooBig)
+		}
+
+		err = badger.NewBulkPublisher(db, r, badger.PublisherConfig{}).Publish("topic", messages...)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		for _, exp := range messages {
+			assertMessageReceived(t, ch, time.Second, exp, true)
+		}
+	})
+
+	t.Run("should not rediscover the transaction limit for each batch", func(t *testing.T) {
+		r := badger.NewRegistry(db, badger.RegistryConfig{Prefix: "limit"})
+		defer r.Close()
+
+		_, err := r.Register("topic", "")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		messages := newLargeMessages(1000, 512)
+
+		marshaler := new(countingMarshaler)
+		err = badger.NewBulkPublisher(db, r, badger.PublisherConfig{Marshaler: marshaler}).Publish("topic", messages...)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		// only the messages in the first batch are marshaled twice
+		act := int(marshaler.count.Load())
+		if act <= len(messages) || act > len(messages)*3/2 {
+			t.Errorf("got %d marshals, expected %d plus the first batch", act, len(messages))
+		}
+	})
+
+	t.Run("should return an error if messages are partially published", func(t *testing.T) {
+		r := badger.NewRegistry(db, badger.RegistryConfig{Prefix: "partial"})
+		defer r.Close()
+
+		_, err := r.Register("topic", "")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		messages := append(newLargeMessages(300, 512), newMessage("invalid", badger.PriorityKey, "invalid"))
+
+		var partial *badger.PartialPublishError
+		err = badger.NewBulkPublisher(db, r, badger.PublisherConfig{}).Publish("topic", messages...)
+		if !errors.As(err, &partial) {
+			t.Fatalf("got %v, expected %T", err, partial)
+		}
+
+		if partial.Published < 1 || partial.Published >= len(messages) {
+			t.Errorf("got %d, expected partial publish", partial.Published)
+		}
+	})
+}
+
+type countingMarshaler struct {
+	badger.JSONMarshaler
+	count atomic.Int64
+}
+
+func (m *countingMarshaler) Marshal(pm badger.PersistedMessage) ([]byte, error) {
+	m.count.Add(1)
+	return m.JSONMarshaler.Marshal(pm)
+}
+
+func newLargeMessages(count int, size int) []*message.Message {
+	messages := make([]*message.Message, count)
+	for i := range messages {
+		messages[i] = newMessage(string(bytes.Repeat([]byte{'a' + byte(i%26)}, size)))
+	}
+	return messages
+}
@@ -0,0 +1,76 @@
+package badger
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/delay"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// DueTimePolicy specifies how due times outside of the valid range are handled
+type DueTimePolicy int
+
+const (
+	// DueTimeReject rejects messages with out of range due times and is the default
+	DueTimeReject DueTimePolicy = iota
+	// DueTimeClamp clamps out of range due times to the nearest valid due time
+	DueTimeClamp
+	// DueTimeNow delivers messages with out of range due times immediately
+	DueTimeNow
+)
+
+var (
+	// MinDueTime is the earliest due time that can be encoded in a message key
+	MinDueTime = time.Unix(0, 0).UTC()
+	// MaxDueTime is the latest due time that can be encoded in a message key
+	MaxDueTime = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// DelayUntil sets the delay metadata on the message so that it is delivered
+// at the specified time. Unlike the Watermill delay component, the due time
+// is stored with nanosecond precision.
+// The metadata keys are compatible with the Watermill delay component.
+func DelayUntil(m *message.Message, t time.Time) {
+	t = t.UTC()
+
+	m.Metadata.Set(delay.DelayedUntilKey, t.Format(time.RFC3339Nano))
+	m.Metadata.Set(delay.DelayedForKey, time.Until(t).String())
+}
+
+// DelayFor sets the delay metadata on the message so that it is delivered
+// after the specified duration, with nanosecond precision.
+// The metadata keys are compatible with the Watermill delay component.
+func DelayFor(m *message.Message, d time.Duration) {
+	m.Metadata.Set(delay.DelayedUntilKey, time.Now().UTC().Add(d).Format(time.RFC3339Nano))
+	m.Metadata.Set(delay.DelayedForKey, d.String())
+}
+
+// apply returns the due time to use according to the policy
+// ErrInvalidDueTime is returned if the due time is out of range and the policy is DueTimeReject.
+func (p DueTimePolicy) apply(dueAt, now time.Time) (time.Time, error) {
+	if err := validateDueTime(dueAt); err == nil {
+		return dueAt, nil
+	}
+
+	switch p {
+	case DueTimeClamp:
+		if dueAt.Before(MinDueTime) {
+			return MinDueTime, nil
+		}
+		return MaxDueTime, nil
+	case DueTimeNow:
+		return now, nil
+	default:
+		return time.Time{}, validateDueTime(dueAt)
+	}
+}
+
+func validateDueTime(t time.Time) error {
+	if t.Before(MinDueTime) || t.After(MaxDueTime) {
+		return fmt.Errorf("%w: %s is outside of the range %s to %s", ErrInvalidDueTime,
+			t.Format(time.RFC3339Nano), MinDueTime.Format(time.RFC3339Nano), MaxDueTime.Format(time.RFC3339Nano))
+	}
+	return nil
+}
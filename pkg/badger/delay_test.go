@@ -0,0 +1,95 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/delay"
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestDelayUntil(t *testing.T) {
+	t.Run("should set the delay metadata with nanosecond precision", func(t *testing.T) {
+		exp := time.Date(2030, 1, 2, 3, 4, 5, 123456789, time.UTC)
+
+		m := newMessage("payload")
+		badger.DelayUntil(m, exp)
+
+		act, err := time.Parse(time.RFC3339Nano, m.Metadata.Get(delay.DelayedUntilKey))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, act, exp)
+	})
+}
+
+func TestDelayFor(t *testing.T) {
+	t.Run("should set the delay metadata", func(t *testing.T) {
+		m := newMessage("payload")
+		badger.DelayFor(m, 1500*time.Millisecond)
+
+		assertEqual(t, m.Metadata.Get(delay.DelayedForKey), "1.5s")
+
+		until, err := time.Parse(time.RFC3339Nano, m.Metadata.Get(delay.DelayedUntilKey))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		if until.Nanosecond() == 0 {
+			t.Errorf("got %v, expected sub-second precision", until)
+		}
+	})
+}
+
+func TestSubscriber_Delay(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	start := time.Now()
+
+	m1 := newMessage("delayed_for")
+	badger.DelayFor(m1, 300*time.Millisecond)
+
+	m2 := newMessage("delayed_until")
+	badger.DelayUntil(m2, start.Add(150*time.Millisecond))
+
+	m3 := newMessage("immediate")
+
+	err = p.Publish("topic", m1, m2, m3)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		exp   *message.Message
+		delay time.Duration
+	}{
+		{exp: m3},
+		{exp: m2, delay: 150 * time.Millisecond},
+		{exp: m1, delay: 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		assertMessageReceived(t, ch, time.Second, tt.exp, true)
+		if elapsed := time.Since(start); elapsed < tt.delay {
+			t.Errorf("got %v, expected at least %v", elapsed, tt.delay)
+		}
+	}
+}
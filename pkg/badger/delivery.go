@@ -0,0 +1,31 @@
+package badger
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Delivery represents delivery information for a received message
+type Delivery struct {
+	Topic         string
+	Subscription  string
+	Published     time.Time
+	DueAt         time.Time
+	Attempt       int
+	LeaseDeadline time.Time
+}
+
+type deliveryContextKey struct{}
+
+// DeliveryInfo returns the delivery information for the specified message
+// False is returned if the message was not received from a subscriber.
+func DeliveryInfo(m *message.Message) (Delivery, bool) {
+	d, ok := m.Context().Value(deliveryContextKey{}).(Delivery)
+	return d, ok
+}
+
+func withDelivery(ctx context.Context, d Delivery) context.Context {
+	return context.WithValue(ctx, deliveryContextKey{}, d)
+}
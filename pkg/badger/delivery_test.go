@@ -0,0 +1,78 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestDeliveryInfo(t *testing.T) {
+	t.Run("should return false if the message was not received", func(t *testing.T) {
+		_, ok := badger.DeliveryInfo(newMessage("payload"))
+		assertEqual(t, ok, false)
+	})
+
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		Name:              "sub",
+		ReceiveInterval:   10 * time.Millisecond,
+		VisibilityTimeout: 50 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	published := time.Now().UTC()
+	dueAt := published.Add(50 * time.Millisecond)
+
+	m := newMessage("payload")
+	badger.DelayUntil(m, dueAt)
+
+	err = p.Publish("topic", m)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		t.Run("should return the delivery info", func(t *testing.T) {
+			select {
+			case act := <-ch:
+				defer act.Nack()
+
+				d, ok := badger.DeliveryInfo(act)
+				if !ok {
+					t.Fatal("got false, expected true")
+				}
+
+				received := time.Now().UTC()
+
+				assertEqual(t, d.Topic, "topic")
+				assertEqual(t, d.Subscription, "sub")
+				assertEqual(t, d.Attempt, attempt)
+				assertTimeBetween(t, d.Published, published, received)
+				assertTimeBetween(t, d.LeaseDeadline, received, received.Add(50*time.Millisecond))
+				assertEqual(t, d.DueAt, dueAt)
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for message")
+			}
+		})
+	}
+}
+
+func assertTimeBetween(t *testing.T, act, min, max time.Time) {
+	t.Helper()
+
+	if act.Before(min) || act.After(max) {
+		t.Errorf("got %v, expected between %v and %v", act, min, max)
+	}
+}
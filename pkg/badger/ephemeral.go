@@ -0,0 +1,379 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// JanitorConfig represents janitor configuration
+	// An empty value is valid. Prefix must match the registry prefix.
+	JanitorConfig struct {
+		Prefix   string
+		Interval time.Duration
+
+		// HeartbeatTimeout is the duration after which an ephemeral subscription
+		// without a heartbeat is considered to be left behind. It must exceed
+		// the registry HeartbeatInterval. Defaults to 1 minute.
+		HeartbeatTimeout time.Duration
+		Logger           watermill.LoggerAdapter
+	}
+
+	// Janitor deletes leftover ephemeral subscriptions and shared message bodies
+	// Ephemeral subscriptions are deleted when their subscriber closes, but
+	// will remain if the process exits without closing the subscriber. The
+	// janitor periodically deletes ephemeral subscriptions that are not
+	// registered with the registry and whose heartbeat has expired, and shared
+	// bodies with no references.
+	Janitor struct {
+		db       *badger.DB
+		registry Registry
+		config   JanitorConfig
+		quit     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// ephemeralMarker represents an internal persisted ephemeral subscription for marshaling
+	ephemeralMarker struct {
+		Topic        string    `json:"topic"`
+		Subscription string    `json:"subscription"`
+		Heartbeat    time.Time `json:"heartbeat"`
+	}
+)
+
+// NewJanitor returns a new janitor
+func NewJanitor(db *badger.DB, r Registry, c JanitorConfig) *Janitor {
+	c.setDefaults()
+
+	j := &Janitor{
+		db:       db,
+		registry: r,
+		config:   c,
+		quit:     make(chan struct{}),
+	}
+
+	j.wg.Add(1)
+	go j.run()
+
+	return j
+}
+
+// Clean deletes all ephemeral subscriptions that are not registered, returning the number deleted
+// Subscriptions registered by other registries are live while their heartbeat is within HeartbeatTimeout.
+func (j *Janitor) Clean() (int, error) {
+	var markers []ephemeralMarker
+
+	err := j.db.View(func(tx *badger.Txn) error {
+		prefix := generateEphemeralKeyPrefix(j.config.Prefix)
+
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			value, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var m ephemeralMarker
+			if err = json.Unmarshal(value, &m); err != nil {
+				return fmt.Errorf("failed to unmarshal ephemeral marker: %w", err)
+			}
+
+			markers = append(markers, m)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, m := range markers {
+		if time.Since(m.Heartbeat) < j.config.HeartbeatTimeout {
+			continue
+		}
+
+		registered, err := j.isRegistered(m)
+		if err != nil {
+			return count, err
+		}
+		if registered {
+			continue
+		}
+
+		s, err := generateSubscription(j.config.Prefix, m.Topic, m.Subscription, SubscriptionConfig{Ephemeral: true})
+		if err != nil {
+			return count, err
+		}
+
+		if err = deleteSubscription(j.db, j.config.Prefix, s); err != nil {
+			return count, fmt.Errorf("failed to delete subscription: %w", err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// CollectBodies deletes shared message bodies that have no remaining references, returning the number deleted
+// Bodies are written in the same transaction as their references, so bodies
+// without references can only be left behind if a process exits while acking.
+func (j *Janitor) CollectBodies() (int, error) {
+	var orphans [][]byte
+
+	err := j.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := generateBodyKeyPrefix(j.config.Prefix)
+
+		// references are ordered immediately after their body
+		var body []byte
+		var referenced bool
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			key := iter.Item().Key()
+			if body != nil && bytes.HasPrefix(key, body) && key[len(body)] == '.' {
+				referenced = true
+				continue
+			}
+
+			if body != nil && !referenced {
+				orphans = append(orphans, body)
+			}
+
+			body, referenced = nil, false
+			if !bytes.Contains(key[len(prefix):], []byte(".")) {
+				body = iter.Item().KeyCopy(nil)
+			}
+		}
+
+		if body != nil && !referenced {
+			orphans = append(orphans, body)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	wb := j.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, body := range orphans {
+		if err = wb.Delete(body); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = wb.Flush(); err != nil {
+		return 0, err
+	}
+
+	return len(orphans), nil
+}
+
+// Close stops the janitor
+func (j *Janitor) Close() error {
+	select {
+	case <-j.quit:
+	default:
+		close(j.quit)
+		j.wg.Wait()
+	}
+	return nil
+}
+
+func (j *Janitor) run() {
+	defer j.wg.Done()
+
+	for {
+		count, err := j.Clean()
+		if err != nil {
+			j.config.Logger.Error("failed to clean ephemeral subscriptions", err, nil)
+		} else if count > 0 {
+			j.config.Logger.Info("deleted ephemeral subscriptions", watermill.LogFields{"count": count})
+		}
+
+		count, err = j.CollectBodies()
+		if err != nil {
+			j.config.Logger.Error("failed to collect message bodies", err, nil)
+		} else if count > 0 {
+			j.config.Logger.Info("deleted orphaned message bodies", watermill.LogFields{"count": count})
+		}
+
+		select {
+		case <-time.After(j.config.Interval):
+			continue
+		case <-j.quit:
+			return
+		}
+	}
+}
+
+func (j *Janitor) isRegistered(m ephemeralMarker) (bool, error) {
+	subscriptions, err := j.registry.Subscriptions(m.Topic)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range subscriptions {
+		if s.Topic == m.Topic && s.Name == m.Subscription {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *JanitorConfig) setDefaults() {
+	if c.Interval < 1 {
+		c.Interval = time.Minute
+	}
+
+	if c.HeartbeatTimeout < 1 {
+		c.HeartbeatTimeout = time.Minute
+	}
+
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+func writeEphemeralMarker(db *badger.DB, prefix string, s *Subscription) error {
+	key, err := GenerateEphemeralKey(prefix, s.Topic, s.Name)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(ephemeralMarker{
+		Topic:        s.Topic,
+		Subscription: s.Name,
+		Heartbeat:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *badger.Txn) error {
+		return tx.Set(key, value)
+	})
+}
+
+// deleteSubscription deletes all keys for the specified subscription
+// Keys are matched exactly, as subscription prefixes can be prefixes of other
+// subscriptions. The ephemeral marker is deleted last so that the janitor
+// can retry if deletion fails.
+func deleteSubscription(db *badger.DB, prefix string, s *Subscription) error {
+	sequenceKey, err := GenerateSequenceKey(prefix, s.Topic, s.Name)
+	if err != nil {
+		return err
+	}
+
+	markerKey, err := GenerateEphemeralKey(prefix, s.Topic, s.Name)
+	if err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var bodies [][]byte
+	err = db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		deleteKeys := func(prefix []byte, match func(item *badger.Item) (bool, error)) error {
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				ok, err := match(iter.Item())
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+
+				if err := wb.Delete(iter.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		err := deleteKeys(s.MessageKeyPrefix, func(item *badger.Item) (bool, error) {
+			d, err := DecodeMessageKey(item.Key())
+			if err != nil || !bytes.Equal(d.Prefix, s.MessageKeyPrefix) {
+				return false, nil
+			}
+
+			// shared body references are deleted along with the message
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return false, err
+			}
+
+			if _, ref, ok := decodePointer(value); ok {
+				bodies = append(bodies, bodyKey(ref))
+				return true, wb.Delete(ref)
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range [][]byte{s.IndexKeyPrefix, s.QuarantineKeyPrefix} {
+			p = append(slices.Clip(p), '.')
+
+			err = deleteKeys(p, func(item *badger.Item) (bool, error) {
+				return !bytes.Contains(item.Key()[len(p):], []byte(".")), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = wb.Delete(sequenceKey); err != nil {
+		return err
+	}
+
+	if err = wb.Flush(); err != nil {
+		return err
+	}
+
+	for _, body := range bodies {
+		err = db.Update(func(tx *badger.Txn) error {
+			return collectBody(tx, body)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Update(func(tx *badger.Txn) error {
+		return tx.Delete(markerKey)
+	})
+}
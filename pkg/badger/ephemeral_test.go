@@ -0,0 +1,171 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestSubscriber_Ephemeral(t *testing.T) {
+	t.Run("should delete the subscription when the subscriber closes", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			Name:            "sub",
+			ReceiveInterval: 10 * time.Millisecond,
+		})
+
+		_, err := sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{Ephemeral: true})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		durable, err := r.Register("topic", "sub2")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		subscriptions, err := r.Subscriptions("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", newDelayedMessage("payload", time.Hour))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		sut.Close()
+
+		ephemeral := subscriptions[0]
+		assertEqual(t, countKeys(t, ephemeral.MessageKeyPrefix), 1) // includes the durable message
+		assertEqual(t, countKeys(t, ephemeral.IndexKeyPrefix), 1)
+		assertEqual(t, countKeys(t, durable.IndexKeyPrefix), 1)
+
+		subscriptions, err = r.Subscriptions("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertDeepEqual(t, subscriptions, []*badger.Subscription{durable})
+	})
+
+	t.Run("should delete the subscription after the idle timeout", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval: 10 * time.Millisecond,
+		})
+		defer sut.Close()
+
+		ch, err := sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+			Ephemeral:   true,
+			IdleTimeout: 50 * time.Millisecond,
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		select {
+		case _, ok := <-ch:
+			assertEqual(t, ok, false)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for channel to close")
+		}
+
+		err = r.Unregister("topic", "")
+		if !errors.Is(err, badger.ErrRegistrationNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrRegistrationNotFound)
+		}
+	})
+}
+
+func TestJanitor_Clean(t *testing.T) {
+	prefix := uuid.NewString()
+
+	crashed := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer crashed.Close()
+
+	leftover, err := crashed.RegisterWithConfig("topic", "leftover", badger.SubscriptionConfig{Ephemeral: true})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = badger.NewPublisher(testDB, crashed, badger.PublisherConfig{}).Publish("topic", newMessage("payload"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	crashed.Close() // stop the heartbeat without unregistering
+
+	remote := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix, HeartbeatInterval: 10 * time.Millisecond})
+	defer remote.Close()
+
+	live, err := remote.RegisterWithConfig("topic", "live", badger.SubscriptionConfig{Ephemeral: true})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	active, err := r.RegisterWithConfig("topic", "active", badger.SubscriptionConfig{Ephemeral: true})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", newMessage("payload"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = badger.NewPublisher(testDB, remote, badger.PublisherConfig{}).Publish("topic", newMessage("payload"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	sut := badger.NewJanitor(testDB, r, badger.JanitorConfig{
+		Prefix:           prefix,
+		Interval:         10 * time.Millisecond,
+		HeartbeatTimeout: 100 * time.Millisecond,
+	})
+	defer sut.Close()
+
+	t.Run("should delete ephemeral subscriptions with expired heartbeats", func(t *testing.T) {
+		for start := time.Now(); countKeys(t, leftover.MessageKeyPrefix) > 0; {
+			if time.Since(start) > time.Second {
+				t.Fatal("timeout waiting for leftover subscription to be deleted")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should not delete registered ephemeral subscriptions", func(t *testing.T) {
+		count, err := sut.Clean()
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, count, 0)
+		assertEqual(t, countKeys(t, active.MessageKeyPrefix), 1)
+	})
+
+	t.Run("should not delete ephemeral subscriptions registered by other registries", func(t *testing.T) {
+		time.Sleep(200 * time.Millisecond) // exceed the heartbeat timeout
+
+		count, err := sut.Clean()
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, count, 0)
+		assertEqual(t, countKeys(t, live.MessageKeyPrefix), 1)
+	})
+}
@@ -0,0 +1,89 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	// ErrEmptyTopic is returned if the specified topic is an empty string
+	ErrEmptyTopic = errors.New("topic is an empty string")
+
+	// ErrInvalidTopicPattern is returned if a topic pattern cannot be registered
+	ErrInvalidTopicPattern = errors.New("invalid topic pattern")
+
+	// ErrRegistrationExists is returned if the topic/subscription combination is already registered
+	ErrRegistrationExists = errors.New("registration already exists")
+
+	// ErrRegistrationNotFound is returned if the topic/subscription combination is not registered
+	ErrRegistrationNotFound = errors.New("registration not found")
+
+	// ErrRegistryNotConfigurable is returned if a subscription config requires a ConfigurableRegistry
+	ErrRegistryNotConfigurable = errors.New("registry does not support subscription config")
+
+	// ErrInvalidKey is returned if a message key cannot be decoded
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrSubscriberClosed is returned if the subscriber is closed while a message is in flight
+	ErrSubscriberClosed = errors.New("subscriber was closed")
+
+	// ErrTxnTooBig is matched by TxnTooBigError
+	ErrTxnTooBig = errors.New("transaction too big")
+
+	// ErrInvalidDueTime is returned if a message due time cannot be parsed or is out of range
+	ErrInvalidDueTime = errors.New("invalid due time")
+
+	// ErrNoReplyTopic is returned if a request message does not contain a reply topic
+	ErrNoReplyTopic = errors.New("request does not contain a reply topic")
+
+	// ErrNoTopicLog is returned if a subscription start position is specified without a topic log
+	ErrNoTopicLog = errors.New("topic log is not configured")
+
+	// ErrNoShards is returned if a sharded publisher or subscriber is created without shards
+	ErrNoShards = errors.New("no shards specified")
+
+	// ErrMessageNotFound is returned if a pending delayed message does not exist
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// TxnTooBigError is returned if messages cannot be written within the
+// transaction size limits. As messages may have been partially written,
+// the transaction should be discarded. BulkPublisher can be used to split
+// large publishes across multiple transactions.
+type TxnTooBigError struct {
+	Topic string
+}
+
+// Error returns the error message
+func (e *TxnTooBigError) Error() string {
+	return fmt.Sprintf("transaction too big to publish to topic %s", e.Topic)
+}
+
+// Is reports whether the target is ErrTxnTooBig
+func (e *TxnTooBigError) Is(target error) bool {
+	return target == ErrTxnTooBig
+}
+
+// Unwrap returns the underlying Badger error
+func (e *TxnTooBigError) Unwrap() error {
+	return badger.ErrTxnTooBig
+}
+
+// UnmarshalError is returned if a stored message value cannot be unmarshaled
+// Key contains the raw message key at the time of the failure.
+type UnmarshalError struct {
+	Key []byte
+	Err error
+}
+
+// Error returns the error message
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("failed to unmarshal message %x: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying marshaler error
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,80 @@
+package badger_test
+
+import (
+	"errors"
+	"testing"
+
+	badgerdb "github.com/dgraph-io/badger/v4"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func() error
+		exp  error
+	}{
+		{
+			name: "should return ErrEmptyTopic for empty topics",
+			fn: func() error {
+				_, err := badger.GenerateMessageKeyPrefix("", "", "sub")
+				return err
+			},
+			exp: badger.ErrEmptyTopic,
+		},
+		{
+			name: "should return ErrRegistrationExists for duplicate registrations",
+			fn: func() error {
+				r := newRegistry()
+				defer r.Close()
+
+				if _, err := r.Register("topic", "sub"); err != nil {
+					return err
+				}
+
+				_, err := r.Register("topic", "sub")
+				return err
+			},
+			exp: badger.ErrRegistrationExists,
+		},
+		{
+			name: "should return ErrInvalidKey for invalid keys",
+			fn: func() error {
+				_, err := badger.MessageKey("key").DueAt()
+				return err
+			},
+			exp: badger.ErrInvalidKey,
+		},
+		{
+			name: "should match ErrTxnTooBig",
+			fn: func() error {
+				return &badger.TxnTooBigError{Topic: "topic"}
+			},
+			exp: badger.ErrTxnTooBig,
+		},
+		{
+			name: "should match the underlying badger error",
+			fn: func() error {
+				return &badger.TxnTooBigError{Topic: "topic"}
+			},
+			exp: badgerdb.ErrTxnTooBig,
+		},
+		{
+			name: "should unwrap unmarshal errors",
+			fn: func() error {
+				return &badger.UnmarshalError{Key: []byte("key"), Err: errTest}
+			},
+			exp: errTest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if !errors.Is(err, tt.exp) {
+				t.Errorf("got %v, expected %v", err, tt.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package badger
+
+import (
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type (
+	// Filter represents a message metadata filter
+	// Filters are evaluated when messages are published, and messages that
+	// do not match are not written for the subscription.
+	Filter interface {
+		Match(metadata message.Metadata) bool
+	}
+
+	// FilterFunc is a function implementation of the Filter interface
+	FilterFunc func(metadata message.Metadata) bool
+)
+
+// Match returns true if the metadata matches the filter
+func (f FilterFunc) Match(metadata message.Metadata) bool {
+	return f(metadata)
+}
+
+// Equals returns a filter that matches metadata with the specified value
+func Equals(key, value string) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		v, ok := metadata[key]
+		return ok && v == value
+	})
+}
+
+// HasPrefix returns a filter that matches metadata values with the specified prefix
+func HasPrefix(key, prefix string) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		v, ok := metadata[key]
+		return ok && strings.HasPrefix(v, prefix)
+	})
+}
+
+// Exists returns a filter that matches metadata containing the specified key
+func Exists(key string) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		_, ok := metadata[key]
+		return ok
+	})
+}
+
+// And returns a filter that matches if all of the specified filters match
+func And(filters ...Filter) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		for _, f := range filters {
+			if !f.Match(metadata) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or returns a filter that matches if any of the specified filters match
+func Or(filters ...Filter) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		for _, f := range filters {
+			if f.Match(metadata) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not returns a filter that matches if the specified filter does not match
+func Not(f Filter) Filter {
+	return FilterFunc(func(metadata message.Metadata) bool {
+		return !f.Match(metadata)
+	})
+}
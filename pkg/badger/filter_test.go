@@ -0,0 +1,94 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestFilter(t *testing.T) {
+	metadata := message.Metadata{"type": "order.created", "region": "eu"}
+
+	tests := []struct {
+		name string
+		sut  badger.Filter
+		exp  bool
+	}{
+		{name: "equals should match equal values", sut: badger.Equals("region", "eu"), exp: true},
+		{name: "equals should not match different values", sut: badger.Equals("region", "us")},
+		{name: "equals should not match missing keys", sut: badger.Equals("missing", "")},
+		{name: "has prefix should match prefixed values", sut: badger.HasPrefix("type", "order."), exp: true},
+		{name: "has prefix should not match other values", sut: badger.HasPrefix("type", "payment.")},
+		{name: "exists should match existing keys", sut: badger.Exists("type"), exp: true},
+		{name: "exists should not match missing keys", sut: badger.Exists("missing")},
+		{
+			name: "and should match if all filters match",
+			sut:  badger.And(badger.Exists("type"), badger.Equals("region", "eu")),
+			exp:  true,
+		},
+		{
+			name: "and should not match if any filter does not match",
+			sut:  badger.And(badger.Exists("type"), badger.Equals("region", "us")),
+		},
+		{
+			name: "or should match if any filter matches",
+			sut:  badger.Or(badger.Equals("region", "us"), badger.Equals("region", "eu")),
+			exp:  true,
+		},
+		{
+			name: "or should not match if no filters match",
+			sut:  badger.Or(badger.Equals("region", "us"), badger.Exists("missing")),
+		},
+		{name: "not should negate the filter", sut: badger.Not(badger.Exists("missing")), exp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, tt.sut.Match(metadata), tt.exp)
+		})
+	}
+}
+
+func TestSubscriber_Filter(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+		Filter: badger.Equals("region", "eu"),
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	subscriptions, err := r.Subscriptions("topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	exp := newMessage("eu", "region", "eu")
+
+	err = p.Publish("topic", newMessage("us", "region", "us"), exp, newMessage("none"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should not write non-matching messages", func(t *testing.T) {
+		assertEqual(t, countKeys(t, subscriptions[0].MessageKeyPrefix), 1)
+	})
+
+	t.Run("should deliver matching messages", func(t *testing.T) {
+		assertMessageReceived(t, ch, time.Second, exp, true)
+	})
+}
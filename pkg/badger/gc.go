@@ -0,0 +1,198 @@
+package badger
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// GarbageCollectorConfig represents garbage collector configuration
+	// An empty value is valid, collecting garbage every 10 minutes by default.
+	GarbageCollectorConfig struct {
+		// Interval is the maximum interval between garbage collection runs
+		Interval time.Duration
+
+		// CheckInterval is the interval at which the value log size is checked
+		// against GrowthThreshold
+		CheckInterval time.Duration
+
+		// GrowthThreshold triggers garbage collection before the next interval
+		// once the value log has grown by the specified number of bytes
+		// Growth is measured using the size reported by Badger, which is only
+		// refreshed about once a minute and counts the active value log file at
+		// its preallocated size. As a result growth is detected up to a minute
+		// late regardless of CheckInterval, and only as value log files are
+		// rotated. If zero, garbage collection runs only at the specified interval.
+		GrowthThreshold int64
+
+		// DiscardRatio is the minimum ratio of garbage that a value log file
+		// must contain for it to be rewritten
+		DiscardRatio float64
+
+		// Flatten specifies that the LSM tree is flattened before collection,
+		// which ensures that discard statistics reflect deleted keys
+		Flatten        bool
+		FlattenWorkers int
+
+		Metrics Metrics
+		Logger  watermill.LoggerAdapter
+	}
+
+	// GarbageCollector periodically runs Badger value log garbage collection
+	// Leasing and acking messages continually rewrites and deletes keys, so the
+	// value log grows unless garbage collection is run.
+	GarbageCollector struct {
+		db     *badger.DB
+		config GarbageCollectorConfig
+		quit   chan struct{}
+		wg     sync.WaitGroup
+	}
+)
+
+// NewGarbageCollector returns a new garbage collector
+// Garbage collection runs in the background until the collector is closed.
+func NewGarbageCollector(db *badger.DB, c GarbageCollectorConfig) *GarbageCollector {
+	c.setDefaults()
+
+	g := &GarbageCollector{
+		db:     db,
+		config: c,
+		quit:   make(chan struct{}),
+	}
+
+	g.wg.Add(1)
+	go g.run()
+
+	return g
+}
+
+// Collect flattens the LSM tree if configured and rewrites value log files
+// until no further files can be rewritten, or the collector is closed
+func (g *GarbageCollector) Collect() (GCStats, error) {
+	start := time.Now()
+	var stats GCStats
+
+	if g.config.Flatten {
+		if err := g.db.Flatten(g.config.FlattenWorkers); err != nil {
+			return stats, err
+		}
+	}
+
+	for !g.closed() {
+		err := g.db.RunValueLogGC(g.config.DiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Rewrites++
+	}
+
+	stats.Duration = time.Since(start)
+	stats.LSMSize, stats.VLogSize = g.db.Size()
+
+	g.config.Metrics.ValueLogGC(stats)
+	return stats, nil
+}
+
+// Close stops the garbage collector, waiting for any in progress run to complete
+func (g *GarbageCollector) Close() error {
+	select {
+	case <-g.quit:
+	default:
+		close(g.quit)
+		g.wg.Wait()
+	}
+	return nil
+}
+
+func (g *GarbageCollector) closed() bool {
+	select {
+	case <-g.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *GarbageCollector) run() {
+	defer g.wg.Done()
+
+	_, vlogSize := g.db.Size()
+	collectedAt := time.Now()
+
+	for {
+		select {
+		case <-time.After(g.config.CheckInterval):
+		case <-g.quit:
+			return
+		}
+
+		if !g.isDue(collectedAt, vlogSize) {
+			continue
+		}
+
+		stats, err := g.Collect()
+		if err != nil {
+			g.config.Logger.Error("failed to collect value log garbage", err, nil)
+		} else {
+			g.config.Logger.Debug("collected value log garbage", watermill.LogFields{
+				"rewrites":  stats.Rewrites,
+				"duration":  stats.Duration,
+				"vlog_size": stats.VLogSize,
+			})
+		}
+
+		_, vlogSize = g.db.Size()
+		collectedAt = time.Now()
+	}
+}
+
+// isDue returns true if the interval has elapsed or the value log has grown
+// by the growth threshold since the last run
+// The active value log file is preallocated, so file sizes on disk do not
+// reflect the bytes written more precisely than the size reported by Badger.
+func (g *GarbageCollector) isDue(collectedAt time.Time, vlogSize int64) bool {
+	if time.Since(collectedAt) >= g.config.Interval {
+		return true
+	}
+
+	if g.config.GrowthThreshold < 1 {
+		return false
+	}
+
+	_, size := g.db.Size()
+	return size-vlogSize >= g.config.GrowthThreshold
+}
+
+func (c *GarbageCollectorConfig) setDefaults() {
+	if c.Interval < 1 {
+		c.Interval = 10 * time.Minute
+	}
+
+	if c.CheckInterval < 1 {
+		c.CheckInterval = min(time.Minute, c.Interval)
+	}
+
+	if c.DiscardRatio <= 0 || c.DiscardRatio >= 1 {
+		c.DiscardRatio = 0.5
+	}
+
+	if c.FlattenWorkers < 1 {
+		c.FlattenWorkers = 1
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = NopMetrics{}
+	}
+
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
@@ -0,0 +1,70 @@
+package badger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestGarbageCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name    string
+		flatten bool
+	}{
+		{
+			name: "should collect garbage",
+		},
+		{
+			name:    "should flatten and collect garbage",
+			flatten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := newTestMetrics()
+
+			sut := badger.NewGarbageCollector(testDB, badger.GarbageCollectorConfig{
+				Interval: time.Hour,
+				Flatten:  tt.flatten,
+				Metrics:  metrics,
+			})
+			defer sut.Close()
+
+			stats, err := sut.Collect()
+			if !assertNilError(t, err) {
+				return
+			}
+
+			lsmSize, vlogSize := testDB.Size()
+			assertEqual(t, stats.LSMSize, lsmSize)
+			assertEqual(t, stats.VLogSize, vlogSize)
+			assertEqual(t, metrics.get("gc"), 1)
+			assertEqual(t, metrics.get("gc_rewrites"), stats.Rewrites)
+		})
+	}
+}
+
+func TestGarbageCollector_Close(t *testing.T) {
+	metrics := newTestMetrics()
+
+	sut := badger.NewGarbageCollector(testDB, badger.GarbageCollectorConfig{
+		Interval: 10 * time.Millisecond,
+		Metrics:  metrics,
+	})
+
+	for start := time.Now(); metrics.get("gc") < 1; {
+		if time.Since(start) > time.Second {
+			t.Fatal("timeout waiting for garbage collection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assertNilError(t, sut.Close())
+
+	count := metrics.get("gc")
+	time.Sleep(50 * time.Millisecond)
+
+	assertEqual(t, metrics.get("gc"), count)
+}
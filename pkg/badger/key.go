@@ -2,20 +2,28 @@ package badger
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
-	sequenceIdentifier = "sequence"
-	messageIdentifier  = "message"
+	sequenceIdentifier   = "sequence"
+	messageIdentifier    = "message"
+	indexIdentifier      = "index"
+	quarantineIdentifier = "quarantine"
+	scheduleIdentifier   = "_schedule"
+	ephemeralIdentifier  = "_ephemeral"
+	groupIdentifier      = "_group"
+	logIdentifier        = "_log"
+	bodyIdentifier       = "_body"
 )
 
 func GenerateSequenceKey(prefix, topic, subscription string) ([]byte, error) {
 	if topic == "" {
-		return nil, errEmptyTopic
+		return nil, ErrEmptyTopic
 	}
 
 	key := topic + "." + sequenceIdentifier
@@ -27,16 +35,141 @@ func GenerateSequenceKey(prefix, topic, subscription string) ([]byte, error) {
 
 func GenerateMessageKeyPrefix(prefix, topic, subscription string) ([]byte, error) {
 	if topic == "" {
-		return nil, errEmptyTopic
+		return nil, ErrEmptyTopic
 	}
 
 	key := topic + "." + messageIdentifier
 	key = applyKeyPrefix(key, prefix)
 	key = applyKeySuffix(key, subscription)
 
+	if len(key) > maxMessageKeyPrefixLen {
+		return nil, fmt.Errorf("%w: prefix exceeds %d bytes", ErrInvalidKey, maxMessageKeyPrefixLen)
+	}
+
+	return []byte(key), nil
+}
+
+func GenerateIndexKeyPrefix(prefix, topic, subscription string) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	key := topic + "." + indexIdentifier
+	key = applyKeyPrefix(key, prefix)
+	key = applyKeySuffix(key, subscription)
+
 	return []byte(key), nil
 }
 
+func GenerateQuarantineKeyPrefix(prefix, topic, subscription string) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	key := topic + "." + quarantineIdentifier
+	key = applyKeyPrefix(key, prefix)
+	key = applyKeySuffix(key, subscription)
+
+	return []byte(key), nil
+}
+
+// GenerateQuarantineKey returns the quarantine key for the specified quarantined message ID
+func GenerateQuarantineKey(prefix []byte, id string) []byte {
+	return []byte(string(prefix) + "." + id)
+}
+
+// GenerateIndexKey returns the index key for the specified message UUID
+func GenerateIndexKey(prefix []byte, uuid string) []byte {
+	return []byte(string(prefix) + "." + uuid)
+}
+
+func GenerateScheduleKey(prefix, name string) ([]byte, error) {
+	if name == "" {
+		return nil, errEmptyScheduleName
+	}
+
+	key := scheduleIdentifier + "." + name
+	key = applyKeyPrefix(key, prefix)
+
+	return []byte(key), nil
+}
+
+func generateScheduleKeyPrefix(prefix string) []byte {
+	return []byte(applyKeyPrefix(scheduleIdentifier, prefix) + ".")
+}
+
+// GenerateEphemeralKey returns the marker key for the specified ephemeral subscription
+func GenerateEphemeralKey(prefix, topic, subscription string) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	key := ephemeralIdentifier + "." + topic
+	key = applyKeyPrefix(key, prefix)
+	key = applyKeySuffix(key, subscription)
+
+	return []byte(key), nil
+}
+
+func generateEphemeralKeyPrefix(prefix string) []byte {
+	return []byte(applyKeyPrefix(ephemeralIdentifier, prefix) + ".")
+}
+
+// GenerateGroupKey returns the key for the specified persisted consumer group
+func GenerateGroupKey(prefix, topic, group string) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	key := groupIdentifier + "." + topic
+	key = applyKeyPrefix(key, prefix)
+	key = applyKeySuffix(key, group)
+
+	return []byte(key), nil
+}
+
+func generateGroupKeyPrefix(prefix, topic string) []byte {
+	return []byte(applyKeyPrefix(groupIdentifier+"."+topic, prefix))
+}
+
+// GenerateTopicLogKeyPrefix returns the topic log key prefix for the specified topic
+func GenerateTopicLogKeyPrefix(prefix, topic string) ([]byte, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	key := logIdentifier + "." + topic
+	key = applyKeyPrefix(key, prefix)
+
+	return []byte(key + "."), nil
+}
+
+func generateLogKeyPrefix(prefix string) []byte {
+	return []byte(applyKeyPrefix(logIdentifier, prefix) + ".")
+}
+
+func generateLogSequenceKey(prefix string) []byte {
+	return []byte(applyKeyPrefix(logIdentifier+"_"+sequenceIdentifier, prefix))
+}
+
+func generateLogBarrierKey(prefix string) []byte {
+	return []byte(applyKeyPrefix(logIdentifier+"_barrier", prefix))
+}
+
+// GenerateBodyKey returns the key for the specified shared message body
+func GenerateBodyKey(prefix, id string) []byte {
+	return []byte(applyKeyPrefix(bodyIdentifier+"."+id, prefix))
+}
+
+func generateBodyKeyPrefix(prefix string) []byte {
+	return []byte(applyKeyPrefix(bodyIdentifier, prefix) + ".")
+}
+
+// generateBodyRefKey returns the key for the specified shared message body reference
+func generateBodyRefKey(body []byte, i int) []byte {
+	return []byte(string(body) + "." + strconv.Itoa(i))
+}
+
 func applyKeyPrefix(key, prefix string) string {
 	if prefix != "" {
 		key = prefix + "." + key
@@ -51,51 +184,150 @@ func applyKeySuffix(key, suffix string) string {
 	return key
 }
 
+// GeneratePriorityKeyPrefix returns the key prefix for messages of the specified priority
+func GeneratePriorityKeyPrefix(prefix []byte, priority Priority) []byte {
+	key := make([]byte, len(prefix)+1)
+	copy(key, prefix)
+	key[len(prefix)] = byte(priority)
+
+	return key
+}
+
+// generateDueKeyBound returns the exclusive upper bound for keys in the priority
+// prefix that are due at or before the specified time
+func generateDueKeyBound(prefix []byte, t time.Time) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], uint64(t.UnixNano())+1)
+
+	return key
+}
+
+// MessageKey represents a message key
+// Keys are encoded using the following layout, which orders messages by
+// priority, due time and sequence within each subscription prefix:
+//
+//	prefix | priority (1) | due time (8) | sequence (8) | random ID (16) | prefix length (1) | version (1)
+//
+// The due time is encoded as big endian Unix nanoseconds, which limits due
+// times to the range MinDueTime to MaxDueTime. As the prefix
+// length is stored in a single byte, prefixes are limited to 255 bytes.
 type MessageKey []byte
 
-func EncodeMessageKey(prefix []byte, dueAt time.Time, seq uint64) MessageKey {
+// DecodedMessageKey represents the components of a message key
+type DecodedMessageKey struct {
+	Prefix   []byte
+	Priority Priority
+	DueAt    time.Time
+	Sequence uint64
+	ID       uuid.UUID
+}
+
+const (
+	// messageKeyVersion is the current message key layout version
+	messageKeyVersion = 1
+
+	// messageKeySuffixLen is the length of the key following the prefix
+	messageKeySuffixLen = 1 + 8 + 8 + 16 + 1 + 1
+
+	// maxMessageKeyPrefixLen is the maximum length of a message key prefix
+	maxMessageKeyPrefixLen = 255
+)
+
+// EncodeMessageKey returns a new message key with a random ID
+// ErrInvalidKey is returned if the prefix exceeds 255 bytes, and
+// ErrInvalidDueTime is returned if the due time is out of range.
+func EncodeMessageKey(prefix []byte, priority Priority, dueAt time.Time, seq uint64) (MessageKey, error) {
 	prefixLen := len(prefix)
+	if prefixLen > maxMessageKeyPrefixLen {
+		return nil, fmt.Errorf("%w: prefix exceeds %d bytes", ErrInvalidKey, maxMessageKeyPrefixLen)
+	}
 
-	encoded := make([]byte, prefixLen+8+8+16)
-	encoded[0] = uint8(prefixLen)
+	if err := validateDueTime(dueAt); err != nil {
+		return nil, err
+	}
 
-	copy(encoded[:prefixLen], []byte(prefix))
-	binary.BigEndian.PutUint64(encoded[prefixLen:prefixLen+8], uint64(dueAt.UnixNano()))
-	binary.BigEndian.PutUint64(encoded[prefixLen+8:prefixLen+16], uint64(seq))
+	encoded := make(MessageKey, prefixLen+messageKeySuffixLen)
+	copy(encoded, prefix)
+	encoded[prefixLen] = byte(priority)
+	binary.BigEndian.PutUint64(encoded[prefixLen+1:prefixLen+9], uint64(dueAt.UnixNano()))
+	binary.BigEndian.PutUint64(encoded[prefixLen+9:prefixLen+17], seq)
 
 	random := uuid.New()
-	copy(encoded[prefixLen+16:], random[:])
+	copy(encoded[prefixLen+17:prefixLen+33], random[:])
+
+	encoded[prefixLen+33] = uint8(prefixLen)
+	encoded[prefixLen+34] = messageKeyVersion
+
+	return encoded, nil
+}
 
-	return encoded
+// DecodeMessageKey decodes the specified message key
+// ErrInvalidKey is returned if the key does not match the current layout.
+func DecodeMessageKey(k MessageKey) (DecodedMessageKey, error) {
+	prefixLen, err := k.validate()
+	if err != nil {
+		return DecodedMessageKey{}, err
+	}
+
+	var id uuid.UUID
+	copy(id[:], k[prefixLen+17:prefixLen+33])
+
+	return DecodedMessageKey{
+		Prefix:   k[:prefixLen],
+		Priority: Priority(k[prefixLen]),
+		DueAt:    time.Unix(0, int64(binary.BigEndian.Uint64(k[prefixLen+1:prefixLen+9]))).UTC(),
+		Sequence: binary.BigEndian.Uint64(k[prefixLen+9 : prefixLen+17]),
+		ID:       id,
+	}, nil
 }
 
+// DueAt returns the due time of the message
 func (k MessageKey) DueAt() (time.Time, error) {
-	if err := k.validate(); err != nil {
+	prefixLen, err := k.validate()
+	if err != nil {
 		return time.Time{}, err
 	}
-	keyLen := len(k)
-	nanos := binary.BigEndian.Uint64(k[keyLen-32 : keyLen-24])
 
+	nanos := binary.BigEndian.Uint64(k[prefixLen+1 : prefixLen+9])
 	return time.Unix(0, int64(nanos)).UTC(), nil
 }
 
+// Update returns a copy of the key with the specified due time
+// ErrInvalidDueTime is returned if the due time is out of range.
 func (k MessageKey) Update(dueAt time.Time) (MessageKey, error) {
-	if err := k.validate(); err != nil {
+	prefixLen, err := k.validate()
+	if err != nil {
+		return k, err
+	}
+
+	if err = validateDueTime(dueAt); err != nil {
 		return k, err
 	}
 
 	keyCopy := make(MessageKey, len(k))
 	copy(keyCopy, k)
 
-	keyLen := len(keyCopy)
-	binary.BigEndian.PutUint64(keyCopy[keyLen-32:keyLen-24], uint64(dueAt.UnixNano()))
+	binary.BigEndian.PutUint64(keyCopy[prefixLen+1:prefixLen+9], uint64(dueAt.UnixNano()))
 
 	return keyCopy, nil
 }
 
-func (k MessageKey) validate() error {
-	if len(k) < 34 { // 0 + 1 + 1 + 8 + 8 + 16
-		return errors.New("invalid key")
+// validate returns the prefix length if the key matches the current layout
+func (k MessageKey) validate() (int, error) {
+	keyLen := len(k)
+	if keyLen < messageKeySuffixLen {
+		return 0, fmt.Errorf("%w: key is too short", ErrInvalidKey)
+	}
+
+	if version := k[keyLen-1]; version != messageKeyVersion {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrInvalidKey, version)
 	}
-	return nil
+
+	prefixLen := int(k[keyLen-2])
+	if prefixLen != keyLen-messageKeySuffixLen {
+		return 0, fmt.Errorf("%w: prefix length mismatch", ErrInvalidKey)
+	}
+
+	return prefixLen, nil
 }
@@ -2,9 +2,12 @@ package badger_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/stevecallear/watermill-badger/pkg/badger"
 )
 
@@ -108,6 +111,183 @@ func TestGenerateMessageKeyPrefix(t *testing.T) {
 	}
 }
 
+func TestGenerateIndexKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefix       string
+		topic        string
+		subscription string
+		exp          []byte
+		err          bool
+	}{
+		{
+			name:         "should return an error if the topic is empty",
+			prefix:       "pre",
+			topic:        "",
+			subscription: "sub",
+			err:          true,
+		},
+		{
+			name:         "should permit empty prefix",
+			prefix:       "",
+			topic:        "top",
+			subscription: "sub",
+			exp:          []byte("top.index.sub"),
+		},
+		{
+			name:         "should return the key",
+			prefix:       "pre",
+			topic:        "top",
+			subscription: "sub",
+			exp:          []byte("pre.top.index.sub"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := badger.GenerateIndexKeyPrefix(tt.prefix, tt.topic, tt.subscription)
+			assertErrorExists(t, err, tt.err)
+			if !bytes.Equal(act, tt.exp) {
+				t.Errorf("got %s, expected %s", act, tt.exp)
+			}
+		})
+	}
+}
+
+func TestGenerateScheduleKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefix       string
+		scheduleName string
+		exp          []byte
+		err          bool
+	}{
+		{
+			name:         "should return an error if the name is empty",
+			prefix:       "pre",
+			scheduleName: "",
+			err:          true,
+		},
+		{
+			name:         "should permit empty prefix",
+			prefix:       "",
+			scheduleName: "name",
+			exp:          []byte("_schedule.name"),
+		},
+		{
+			name:         "should return the key",
+			prefix:       "pre",
+			scheduleName: "name",
+			exp:          []byte("pre._schedule.name"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := badger.GenerateScheduleKey(tt.prefix, tt.scheduleName)
+			assertErrorExists(t, err, tt.err)
+			if !bytes.Equal(act, tt.exp) {
+				t.Errorf("got %s, expected %s", act, tt.exp)
+			}
+		})
+	}
+}
+
+func TestGeneratePriorityKeyPrefix(t *testing.T) {
+	act := badger.GeneratePriorityKeyPrefix([]byte("prefix"), badger.PriorityHigh)
+	exp := append([]byte("prefix"), byte(badger.PriorityHigh))
+
+	if !bytes.Equal(act, exp) {
+		t.Errorf("got %v, expected %v", act, exp)
+	}
+}
+
+func TestEncodeMessageKey(t *testing.T) {
+	t.Run("should return an error if the prefix is too long", func(t *testing.T) {
+		_, err := badger.EncodeMessageKey(bytes.Repeat([]byte("a"), 256), badger.PriorityNormal, time.Now(), 1)
+		assertErrorExists(t, err, true)
+	})
+
+	t.Run("should return an error if the due time is out of range", func(t *testing.T) {
+		for _, dueAt := range []time.Time{badger.MinDueTime.Add(-1), badger.MaxDueTime.Add(1)} {
+			_, err := badger.EncodeMessageKey([]byte("prefix"), badger.PriorityNormal, dueAt, 1)
+			if !errors.Is(err, badger.ErrInvalidDueTime) {
+				t.Errorf("got %v, expected %v", err, badger.ErrInvalidDueTime)
+			}
+		}
+	})
+
+	t.Run("should encode the due time range", func(t *testing.T) {
+		for _, exp := range []time.Time{badger.MinDueTime, badger.MaxDueTime} {
+			key := encodeMessageKey(t, []byte("prefix"), badger.PriorityNormal, exp, 1)
+
+			act, err := key.DueAt()
+			if !assertNilError(t, err) {
+				return
+			}
+
+			assertEqual(t, act, exp)
+		}
+	})
+}
+
+func TestDecodeMessageKey(t *testing.T) {
+	dueAt := time.Unix(0, time.Now().UnixNano()).UTC()
+	prefix := bytes.Repeat([]byte("a"), 255)
+
+	valid := encodeMessageKey(t, prefix, badger.PriorityHigh, dueAt, 10)
+
+	tests := []struct {
+		name string
+		sut  badger.MessageKey
+		exp  badger.DecodedMessageKey
+		err  bool
+	}{
+		{
+			name: "should return an error if the key is too short",
+			sut:  valid[len(valid)-34:],
+			err:  true,
+		},
+		{
+			name: "should return an error if the version is invalid",
+			sut:  append(append(badger.MessageKey{}, valid[:len(valid)-1]...), 2),
+			err:  true,
+		},
+		{
+			name: "should return an error if the prefix length is invalid",
+			sut:  valid[1:],
+			err:  true,
+		},
+		{
+			name: "should decode the key",
+			sut:  valid,
+			exp: badger.DecodedMessageKey{
+				Prefix:   prefix,
+				Priority: badger.PriorityHigh,
+				DueAt:    dueAt,
+				Sequence: 10,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := badger.DecodeMessageKey(tt.sut)
+			assertErrorExists(t, err, tt.err)
+			if err != nil {
+				return
+			}
+
+			if act.ID == uuid.Nil {
+				t.Error("got nil ID, expected random ID")
+			}
+
+			act.ID = uuid.Nil
+			assertDeepEqual(t, act, tt.exp)
+		})
+	}
+}
+
 func TestMessageKey_DueAt(t *testing.T) {
 	dueAt := time.Unix(0, time.Now().UnixNano()).UTC()
 
@@ -124,7 +304,7 @@ func TestMessageKey_DueAt(t *testing.T) {
 		},
 		{
 			name: "should return the due at time",
-			sut:  badger.EncodeMessageKey([]byte("prefix"), dueAt, 1),
+			sut:  encodeMessageKey(t, []byte("prefix"), badger.PriorityNormal, dueAt, 1),
 			exp:  dueAt,
 		},
 	}
@@ -156,9 +336,9 @@ func TestMessageKey_Update(t *testing.T) {
 		},
 		{
 			name:  "should update the due at time",
-			sut:   badger.EncodeMessageKey([]byte("prefix"), dueAt, 1),
+			sut:   encodeMessageKey(t, []byte("prefix"), badger.PriorityNormal, dueAt, 1),
 			dueAt: newDueAt,
-			exp:   badger.EncodeMessageKey([]byte("prefix"), newDueAt, 1),
+			exp:   encodeMessageKey(t, []byte("prefix"), badger.PriorityNormal, newDueAt, 1),
 		},
 	}
 
@@ -170,12 +350,27 @@ func TestMessageKey_Update(t *testing.T) {
 				return
 			}
 
-			act := updated[:len(updated)-16]
-			exp := tt.exp[:len(tt.exp)-16]
+			act, err := badger.DecodeMessageKey(updated)
+			if !assertNilError(t, err) {
+				return
+			}
 
-			if !bytes.Equal(act, exp) {
-				t.Errorf("got %v, expected %v", act, exp)
+			exp, err := badger.DecodeMessageKey(tt.exp)
+			if !assertNilError(t, err) {
+				return
 			}
+
+			exp.ID = act.ID
+			assertDeepEqual(t, act, exp)
 		})
 	}
 }
+
+func encodeMessageKey(t *testing.T, prefix []byte, priority badger.Priority, dueAt time.Time, seq uint64) badger.MessageKey {
+	key, err := badger.EncodeMessageKey(prefix, priority, dueAt, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
@@ -0,0 +1,90 @@
+package badger
+
+import "time"
+
+type (
+	// Metrics represents a metrics hook for publishers and subscribers
+	Metrics interface {
+		// MessagesPublished is called when messages have been published to a topic
+		MessagesPublished(topic string, count int, duration time.Duration)
+
+		// MessagesReceived is called with the size of each received batch
+		MessagesReceived(topic, subscription string, count int)
+
+		// MessageAcked is called when a message is acked
+		MessageAcked(topic, subscription string)
+
+		// MessageNacked is called when a message is nacked
+		MessageNacked(topic, subscription string)
+
+		// MessageRedelivered is called when a message is received more than once
+		MessageRedelivered(topic, subscription string)
+
+		// LeaseExpired is called when a message is acked or nacked after its visibility timeout
+		LeaseExpired(topic, subscription string)
+
+		// MessageHandled is called when a message is acked, with the time since it was published
+		MessageHandled(topic, subscription string, latency time.Duration)
+
+		// QueueStats is called periodically with subscription queue statistics
+		QueueStats(topic, subscription string, stats QueueStats)
+
+		// ValueLogGC is called after each value log garbage collection run
+		ValueLogGC(stats GCStats)
+	}
+
+	// QueueStats represents subscription queue statistics
+	QueueStats struct {
+		// Depth is the number of messages in the subscription, including delayed messages
+		// It is limited to SubscriberConfig.StatsScanLimit.
+		Depth int
+
+		// OldestAge is the time since the oldest message that is due was due
+		OldestAge time.Duration
+	}
+
+	// GCStats represents value log garbage collection statistics
+	GCStats struct {
+		// Rewrites is the number of value log files that were rewritten
+		Rewrites int
+
+		// Duration is the time taken to flatten the LSM tree and collect garbage
+		Duration time.Duration
+
+		// LSMSize is the size of the LSM tree in bytes after collection
+		LSMSize int64
+
+		// VLogSize is the size of the value log in bytes after collection
+		VLogSize int64
+	}
+
+	// NopMetrics is a no-op implementation of the Metrics interface
+	NopMetrics struct{}
+)
+
+// MessagesPublished is a no-op
+func (NopMetrics) MessagesPublished(string, int, time.Duration) {}
+
+// MessagesReceived is a no-op
+func (NopMetrics) MessagesReceived(string, string, int) {}
+
+// MessageAcked is a no-op
+func (NopMetrics) MessageAcked(string, string) {}
+
+// MessageNacked is a no-op
+func (NopMetrics) MessageNacked(string, string) {}
+
+// MessageRedelivered is a no-op
+func (NopMetrics) MessageRedelivered(string, string) {}
+
+// LeaseExpired is a no-op
+func (NopMetrics) LeaseExpired(string, string) {}
+
+// MessageHandled is a no-op
+func (NopMetrics) MessageHandled(string, string, time.Duration) {}
+
+// QueueStats is a no-op
+func (NopMetrics) QueueStats(string, string, QueueStats) {}
+
+// ValueLogGC is a no-op
+func (NopMetrics) ValueLogGC(GCStats) {}
@@ -0,0 +1,226 @@
+package badger_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := newTestMetrics()
+
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{Metrics: metrics})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		Name:              "sub",
+		ReceiveInterval:   10 * time.Millisecond,
+		VisibilityTimeout: 20 * time.Millisecond,
+		Metrics:           metrics,
+		StatsInterval:     10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	m1, m2 := newMessage("payload1"), newDelayedMessage("payload2", time.Hour)
+
+	err = p.Publish("topic", m1, m2)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	select {
+	case m := <-ch:
+		time.Sleep(30 * time.Millisecond) // exceed the visibility timeout
+		m.Nack()
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	assertMessageReceived(t, ch, time.Second, m1, true)
+
+	// wait for the stats to be reported after the ack
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		metrics.mu.Lock()
+		depth := metrics.stats.Depth
+		metrics.mu.Unlock()
+
+		if depth == 1 {
+			break
+		}
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	assertEqual(t, metrics.counts["published:topic"], 2)
+	assertEqual(t, metrics.counts["received:topic:sub"], 2)
+	assertEqual(t, metrics.counts["nacked:topic:sub"], 1)
+	assertEqual(t, metrics.counts["acked:topic:sub"], 1)
+	assertEqual(t, metrics.counts["redelivered:topic:sub"], 1)
+	assertEqual(t, metrics.counts["expired:topic:sub"], 1)
+	assertEqual(t, metrics.counts["handled:topic:sub"], 1)
+	assertEqual(t, metrics.stats.Depth, 1)
+}
+
+func TestMetrics_QueueStats(t *testing.T) {
+	t.Run("should limit the number of keys counted", func(t *testing.T) {
+		metrics := newTestMetrics()
+
+		r := newRegistry()
+		defer r.Close()
+
+		s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval: 10 * time.Millisecond,
+			Metrics:         metrics,
+			StatsInterval:   10 * time.Millisecond,
+			StatsScanLimit:  2,
+		})
+		defer s.Close()
+
+		if _, err := s.Subscribe(context.Background(), "topic"); !assertNilError(t, err) {
+			return
+		}
+
+		messages := []*message.Message{
+			newDelayedMessage("payload1", time.Hour),
+			newDelayedMessage("payload2", time.Hour),
+			newDelayedMessage("payload3", time.Hour),
+		}
+
+		err := badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", messages...)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+			metrics.mu.Lock()
+			depth := metrics.stats.Depth
+			metrics.mu.Unlock()
+
+			if depth > 0 {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond) // allow stats to be reported after the publish
+
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+
+		assertEqual(t, metrics.stats.Depth, 2)
+	})
+
+	t.Run("should report stats for batch subscriptions", func(t *testing.T) {
+		metrics := newTestMetrics()
+
+		r := newRegistry()
+		defer r.Close()
+
+		s := badger.NewBatchSubscriber(testDB, r, badger.BatchSubscriberConfig{
+			SubscriberConfig: badger.SubscriberConfig{
+				ReceiveInterval: 10 * time.Millisecond,
+				Metrics:         metrics,
+				StatsInterval:   10 * time.Millisecond,
+			},
+		})
+		defer s.Close()
+
+		if _, err := s.Subscribe(context.Background(), "topic"); !assertNilError(t, err) {
+			return
+		}
+
+		err := badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", newDelayedMessage("payload", time.Hour))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+			metrics.mu.Lock()
+			depth := metrics.stats.Depth
+			metrics.mu.Unlock()
+
+			if depth > 0 {
+				break
+			}
+		}
+
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+
+		assertEqual(t, metrics.stats.Depth, 1)
+	})
+}
+
+type testMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+	stats  badger.QueueStats
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{counts: map[string]int{}}
+}
+
+func (m *testMetrics) add(key string, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[key] += count
+}
+
+func (m *testMetrics) get(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[key]
+}
+
+func (m *testMetrics) MessagesPublished(topic string, count int, _ time.Duration) {
+	m.add("published:"+topic, count)
+}
+
+func (m *testMetrics) MessagesReceived(topic, subscription string, count int) {
+	m.add("received:"+topic+":"+subscription, count)
+}
+
+func (m *testMetrics) MessageAcked(topic, subscription string) {
+	m.add("acked:"+topic+":"+subscription, 1)
+}
+
+func (m *testMetrics) MessageNacked(topic, subscription string) {
+	m.add("nacked:"+topic+":"+subscription, 1)
+}
+
+func (m *testMetrics) MessageRedelivered(topic, subscription string) {
+	m.add("redelivered:"+topic+":"+subscription, 1)
+}
+
+func (m *testMetrics) LeaseExpired(topic, subscription string) {
+	m.add("expired:"+topic+":"+subscription, 1)
+}
+
+func (m *testMetrics) MessageHandled(topic, subscription string, _ time.Duration) {
+	m.add("handled:"+topic+":"+subscription, 1)
+}
+
+func (m *testMetrics) ValueLogGC(stats badger.GCStats) {
+	m.add("gc", 1)
+	m.add("gc_rewrites", stats.Rewrites)
+}
+
+func (m *testMetrics) QueueStats(_, _ string, stats badger.QueueStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = stats
+}
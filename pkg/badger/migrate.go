@@ -0,0 +1,119 @@
+package badger
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// legacyMessageKeySuffixLen is the length of the unversioned key layout following the prefix
+// Unversioned keys contain the due time, sequence and random ID without a priority or trailer.
+const legacyMessageKeySuffixLen = 8 + 8 + 16
+
+// MigrateMessageKeys rewrites unversioned message keys for the specified subscription
+// using the current key layout, returning the number of migrated messages. Values
+// are rewritten with a value header, and index entries for pending delayed messages
+// are updated to reference the migrated keys.
+// Migration should be performed before subscribing, and can safely be repeated if
+// it fails part way through.
+func MigrateMessageKeys(db *badger.DB, s *Subscription) (int, error) {
+	var count int
+
+	err := migrate(db, s.MessageKeyPrefix, func(key, value []byte) ([]byte, []byte, bool) {
+		newKey, ok := migrateMessageKey(s.MessageKeyPrefix, key)
+		if !ok {
+			return nil, nil, false
+		}
+
+		dueAt, err := newKey.DueAt()
+		if err != nil {
+			return nil, nil, false
+		}
+
+		// unversioned keys always have unversioned values
+		count++
+		return newKey, encodeValue(valueHeader{dueAt: dueAt}, value), true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate messages: %w", err)
+	}
+
+	err = migrate(db, s.IndexKeyPrefix, func(key, value []byte) ([]byte, []byte, bool) {
+		newValue, ok := migrateMessageKey(s.MessageKeyPrefix, value)
+		if !ok {
+			return nil, nil, false
+		}
+
+		return key, newValue, true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate index: %w", err)
+	}
+
+	return count, nil
+}
+
+// migrate applies fn to each entry with the specified prefix
+// If fn returns true then the entry is replaced with the returned key and value.
+// New entries are written before old entries are deleted, so no entries are
+// lost if the write batch is partially applied.
+func migrate(db *badger.DB, prefix []byte, fn func(key, value []byte) ([]byte, []byte, bool)) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(tx *badger.Txn) error {
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+
+			key := item.KeyCopy(nil)
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			newKey, newValue, ok := fn(key, value)
+			if !ok {
+				continue
+			}
+
+			if err = wb.Set(newKey, newValue); err != nil {
+				return err
+			}
+
+			if string(newKey) != string(key) {
+				if err = wb.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+// migrateMessageKey returns the current layout for an unversioned message key
+// Unversioned keys are assigned normal priority. Keys belonging to other
+// prefixes are identified by length and ignored.
+func migrateMessageKey(prefix, key []byte) (MessageKey, bool) {
+	prefixLen := len(prefix)
+	if len(key) != prefixLen+legacyMessageKeySuffixLen {
+		return nil, false
+	}
+
+	newKey := make(MessageKey, prefixLen+messageKeySuffixLen)
+	copy(newKey, prefix)
+	newKey[prefixLen] = byte(PriorityNormal)
+	copy(newKey[prefixLen+1:], key[prefixLen:])
+	newKey[prefixLen+33] = uint8(prefixLen)
+	newKey[prefixLen+34] = messageKeyVersion
+
+	return newKey, true
+}
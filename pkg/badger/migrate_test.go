@@ -0,0 +1,146 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestMigrateMessageKeys(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	subscription, err := r.Register("topic", "legacy")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	exp := newMessage("payload")
+	// legacy values can begin with the same bytes as a value header
+	value, err := legacyMarshaler{}.Marshal(badger.PersistedMessage{
+		UUID:     exp.UUID,
+		Metadata: exp.Metadata,
+		Payload:  exp.Payload,
+		Created:  time.Now().UTC(),
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	key := encodeLegacyMessageKey(subscription.MessageKeyPrefix, time.Now().UTC(), 1)
+	indexKey := badger.GenerateIndexKey(subscription.IndexKeyPrefix, exp.UUID)
+
+	err = testDB.Update(func(tx *badgerdb.Txn) error {
+		if err := tx.Set(key, value); err != nil {
+			return err
+		}
+		return tx.Set(indexKey, key)
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should migrate unversioned keys", func(t *testing.T) {
+		count, err := badger.MigrateMessageKeys(testDB, subscription)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, count, 1)
+		assertEqual(t, countKeys(t, subscription.MessageKeyPrefix), 1)
+	})
+
+	t.Run("should update the index", func(t *testing.T) {
+		err := testDB.View(func(tx *badgerdb.Txn) error {
+			item, err := tx.Get(indexKey)
+			if err != nil {
+				return err
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			decoded, err := badger.DecodeMessageKey(value)
+			if err != nil {
+				return err
+			}
+
+			assertEqual(t, decoded.Priority, badger.PriorityNormal)
+			assertEqual(t, decoded.Sequence, uint64(1))
+			return nil
+		})
+		assertNilError(t, err)
+	})
+
+	t.Run("should not migrate current keys", func(t *testing.T) {
+		count, err := badger.MigrateMessageKeys(testDB, subscription)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, count, 0)
+	})
+
+	t.Run("should deliver migrated messages", func(t *testing.T) {
+		s := badger.NewSubscriber(testDB, &testRegistry{
+			registerFn: func(string, string) (*badger.Subscription, error) {
+				return subscription, nil
+			},
+		}, badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond, Marshaler: legacyMarshaler{}})
+		defer s.Close()
+
+		ch, err := s.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, exp, true)
+	})
+}
+
+// legacyMarshaler marshals values with a prefix that matches the value header magic and version
+type legacyMarshaler struct {
+	badger.JSONMarshaler
+}
+
+var legacyValuePrefix = append([]byte{0xba, 0x01}, make([]byte, 14)...)
+
+func (m legacyMarshaler) Marshal(pm badger.PersistedMessage) ([]byte, error) {
+	b, err := m.JSONMarshaler.Marshal(pm)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(slices.Clone(legacyValuePrefix), b...), nil
+}
+
+func (m legacyMarshaler) Unmarshal(b []byte) (badger.PersistedMessage, error) {
+	if !bytes.HasPrefix(b, legacyValuePrefix) {
+		return badger.PersistedMessage{}, errors.New("missing prefix")
+	}
+
+	return m.JSONMarshaler.Unmarshal(b[len(legacyValuePrefix):])
+}
+
+// encodeLegacyMessageKey returns a key using the unversioned layout written by earlier versions
+func encodeLegacyMessageKey(prefix []byte, dueAt time.Time, seq uint64) []byte {
+	key := append(slices.Clone(prefix), make([]byte, 32)...)
+	binary.BigEndian.PutUint64(key[len(prefix):], uint64(dueAt.UnixNano()))
+	binary.BigEndian.PutUint64(key[len(prefix)+8:], seq)
+
+	id := uuid.New()
+	copy(key[len(prefix)+16:], id[:])
+
+	return key
+}
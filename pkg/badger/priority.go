@@ -0,0 +1,131 @@
+package badger
+
+import (
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Priority represents a message priority level
+type Priority uint8
+
+const (
+	// PriorityLow represents low priority messages, such as bulk backfills
+	PriorityLow Priority = iota
+	// PriorityNormal represents normal priority messages and is the default
+	PriorityNormal
+	// PriorityHigh represents high priority messages, such as urgent commands
+	PriorityHigh
+)
+
+// PriorityKey is the metadata key used to specify message priority
+const PriorityKey = "_watermill_badger_priority"
+
+// priorities contains all priority levels in descending order
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// SetPriority sets the priority metadata on the message
+func SetPriority(m *message.Message, p Priority) {
+	m.Metadata.Set(PriorityKey, p.String())
+}
+
+// ParsePriority parses the specified priority string
+func ParsePriority(s string) (Priority, error) {
+	for _, p := range priorities {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid priority: %s", s)
+}
+
+// String returns the string representation of the priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("priority(%d)", p)
+	}
+}
+
+func getPriority(m *message.Message) (Priority, error) {
+	if m.Metadata == nil {
+		return PriorityNormal, nil
+	}
+
+	value, exists := m.Metadata[PriorityKey]
+	if !exists {
+		return PriorityNormal, nil
+	}
+
+	return ParsePriority(value)
+}
+
+// priorityCredits contains the weighted share of each priority level that
+// has not yet been allocated. Credits are carried between batches, so that
+// levels are served in turn when batches are smaller than the total weight.
+type priorityCredits map[Priority]int
+
+// allocatePriorities returns the number of messages to take from each
+// priority level given the available message counts. Each level is first
+// allocated its weighted share of the batch to prevent starvation, with any
+// remaining capacity filled in descending priority order. Weighted levels with
+// available messages are allocated at least one message if the batch is large
+// enough, and credits are updated with the unallocated share of each level.
+func allocatePriorities(available map[Priority]int, batchSize int, weights map[Priority]int, credits priorityCredits) map[Priority]int {
+	allocated := make(map[Priority]int, len(priorities))
+	remaining := batchSize
+
+	var totalWeight, waiting int
+	for _, p := range priorities {
+		totalWeight += weights[p]
+		if weights[p] > 0 && available[p] > 0 {
+			waiting++
+		}
+	}
+
+	shares := make(map[Priority]int, len(priorities))
+	if totalWeight > 0 {
+		for _, p := range priorities {
+			if weights[p] < 1 || available[p] < 1 {
+				continue
+			}
+
+			shares[p] = credits[p] + batchSize*weights[p]
+
+			reserved := shares[p] / totalWeight
+			if batchSize >= waiting {
+				reserved = max(reserved, 1)
+			}
+
+			n := min(reserved, available[p], remaining)
+
+			allocated[p] = n
+			remaining -= n
+		}
+	}
+
+	for _, p := range priorities {
+		n := min(available[p]-allocated[p], remaining)
+
+		allocated[p] += n
+		remaining -= n
+	}
+
+	for _, p := range priorities {
+		if weights[p] < 1 || available[p] < 1 {
+			// credits are not accumulated while a level has no messages
+			delete(credits, p)
+			continue
+		}
+
+		credits[p] = max(shares[p]-allocated[p]*totalWeight, -totalWeight)
+	}
+
+	return allocated
+}
@@ -0,0 +1,132 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		exp   badger.Priority
+		err   bool
+	}{
+		{
+			name:  "should return an error if the value is invalid",
+			value: "invalid",
+			err:   true,
+		},
+		{
+			name:  "should parse low priority",
+			value: "low",
+			exp:   badger.PriorityLow,
+		},
+		{
+			name:  "should parse normal priority",
+			value: "normal",
+			exp:   badger.PriorityNormal,
+		},
+		{
+			name:  "should parse high priority",
+			value: "high",
+			exp:   badger.PriorityHigh,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := badger.ParsePriority(tt.value)
+			assertErrorExists(t, err, tt.err)
+			assertEqual(t, act, tt.exp)
+		})
+	}
+}
+
+func TestSubscriber_Priority(t *testing.T) {
+	high1, high2 := newPriorityMessage("high1", badger.PriorityHigh), newPriorityMessage("high2", badger.PriorityHigh)
+	low1, low2 := newPriorityMessage("low1", badger.PriorityLow), newPriorityMessage("low2", badger.PriorityLow)
+
+	tests := []struct {
+		name      string
+		batchSize int
+		weights   map[badger.Priority]int
+		exp       []*message.Message
+	}{
+		{
+			name:      "should receive messages in priority order",
+			batchSize: 2,
+			exp:       []*message.Message{high1, high2, low1, low2},
+		},
+		{
+			name:      "should apply priority weights",
+			batchSize: 2,
+			weights:   map[badger.Priority]int{badger.PriorityHigh: 1, badger.PriorityLow: 1},
+			exp:       []*message.Message{high1, low1, high2, low2},
+		},
+		{
+			name:      "should apply priority weights to batches smaller than the total weight",
+			batchSize: 1,
+			weights:   map[badger.Priority]int{badger.PriorityHigh: 1, badger.PriorityLow: 1},
+			exp:       []*message.Message{high1, low1, high2, low2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry()
+			defer r.Close()
+
+			p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+			defer p.Close()
+
+			s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+				ReceiveInterval:  10 * time.Millisecond,
+				ReceiveBatchSize: tt.batchSize,
+				PriorityWeights:  tt.weights,
+			})
+			defer s.Close()
+
+			ch, err := s.Subscribe(context.Background(), "topic")
+			if !assertNilError(t, err) {
+				return
+			}
+
+			err = p.Publish("topic", low1, low2, high1, high2)
+			if !assertNilError(t, err) {
+				return
+			}
+
+			for _, exp := range tt.exp {
+				assertMessageReceived(t, ch, time.Second, exp, true)
+			}
+		})
+	}
+
+	t.Run("should return an error if the priority is invalid", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		_, err := r.Register("topic", "")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+		defer p.Close()
+
+		err = p.Publish("topic", newMessage("payload", badger.PriorityKey, "invalid"))
+		assertErrorExists(t, err, true)
+	})
+}
+
+func newPriorityMessage(payload string, p badger.Priority) *message.Message {
+	m := newMessage(payload)
+	badger.SetPriority(m, p)
+	return m
+}
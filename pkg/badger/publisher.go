@@ -1,10 +1,13 @@
 package badger
 
 import (
-	"errors"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -12,6 +15,37 @@ type (
 	// An empty value is valid, using JSON marshaling by default
 	PublisherConfig struct {
 		Marshaler Marshaler
+		Metrics   Metrics
+
+		// DueTimePolicy specifies how delayed messages with due times outside
+		// of the range MinDueTime to MaxDueTime are handled
+		DueTimePolicy DueTimePolicy
+
+		// TopicLog is the topic log that published messages are written to
+		// If nil, messages are written only to the registered subscriptions.
+		TopicLog *TopicLog
+
+		// Storage specifies how messages are stored for subscriptions
+		// If StorageShared, message bodies are written once under the registry
+		// prefix, and orphaned bodies are deleted by a janitor with the same prefix.
+		Storage StorageMode
+
+		// Prefix is the body key prefix for subscriptions without a BodyKeyPrefix,
+		// which are only returned by custom registry implementations
+		Prefix string
+
+		// InlineThreshold is the maximum marshaled message size in bytes that
+		// is stored inline with the message key when using StorageCopy.
+		// Larger messages are stored once per subscription under a stable body
+		// key, so that leasing rewrites only a small pointer. If zero, 1KB is
+		// used, and if negative all messages are stored inline.
+		InlineThreshold int
+
+		// Retry specifies how publishes are retried if the transaction conflicts
+		Retry RetryConfig
+
+		TracerProvider trace.TracerProvider
+		Propagator     propagation.TextMapPropagator
 	}
 
 	// Publisher represents a BadgerDB Watermill publisher
@@ -22,8 +56,6 @@ type (
 	}
 )
 
-var errEmptyTopic = errors.New("topic is an empty string")
-
 // NewPublisher returns a new publisher using the specified Badger DB
 func NewPublisher(db *badger.DB, r Registry, c PublisherConfig) Publisher {
 	c.setDefaults()
@@ -37,10 +69,36 @@ func NewPublisher(db *badger.DB, r Registry, c PublisherConfig) Publisher {
 
 // Publish publishes the specified messages
 func (p Publisher) Publish(topic string, messages ...*message.Message) error {
-	return p.db.Update(func(tx *badger.Txn) error {
+	start := time.Now()
+
+	err := update(p.db, p.config.Retry, func(tx *badger.Txn) error {
 		publisher := NewTxPublisher(tx, p.registry, p.config)
 		return publisher.Publish(topic, messages...)
 	})
+	if err != nil {
+		return err
+	}
+
+	p.config.Metrics.MessagesPublished(topic, len(messages), time.Since(start))
+	return nil
+}
+
+// Cancel deletes the pending delayed message with the specified UUID
+// ErrMessageNotFound is returned if no pending message exists.
+func (p Publisher) Cancel(topic string, uuid string) error {
+	return update(p.db, p.config.Retry, func(tx *badger.Txn) error {
+		publisher := NewTxPublisher(tx, p.registry, p.config)
+		return publisher.Cancel(topic, uuid)
+	})
+}
+
+// Reschedule updates the due time of the pending delayed message with the specified UUID
+// ErrMessageNotFound is returned if no pending message exists.
+func (p Publisher) Reschedule(topic string, uuid string, dueAt time.Time) error {
+	return update(p.db, p.config.Retry, func(tx *badger.Txn) error {
+		publisher := NewTxPublisher(tx, p.registry, p.config)
+		return publisher.Reschedule(topic, uuid, dueAt)
+	})
 }
 
 func (p Publisher) Close() error {
@@ -51,4 +109,22 @@ func (c *PublisherConfig) setDefaults() {
 	if c.Marshaler == nil {
 		c.Marshaler = JSONMarshaler{}
 	}
+
+	c.Retry.setDefaults()
+
+	if c.InlineThreshold == 0 {
+		c.InlineThreshold = 1 << 10
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = NopMetrics{}
+	}
+
+	if c.TracerProvider == nil {
+		c.TracerProvider = otel.GetTracerProvider()
+	}
+
+	if c.Propagator == nil {
+		c.Propagator = otel.GetTextMapPropagator()
+	}
 }
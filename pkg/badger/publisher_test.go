@@ -2,9 +2,11 @@ package badger_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/ThreeDotsLabs/watermill/components/delay"
 	"github.com/ThreeDotsLabs/watermill/message"
 
 	"github.com/stevecallear/watermill-badger/pkg/badger"
@@ -130,3 +132,230 @@ func testPublisher_Publish(
 		})
 	}
 }
+
+func TestPublisher_Cancel(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer sut.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	cancelled := newMessage("cancelled")
+	badger.DelayFor(cancelled, 200*time.Millisecond)
+
+	delayed := newMessage("delayed")
+	badger.DelayFor(delayed, 200*time.Millisecond)
+
+	immediate := newMessage("immediate")
+
+	err = sut.Publish("topic", cancelled, delayed, immediate)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should return an error if the topic is empty", func(t *testing.T) {
+		err := sut.Cancel("", cancelled.UUID)
+		assertErrorExists(t, err, true)
+	})
+
+	t.Run("should return an error if the message does not exist", func(t *testing.T) {
+		err := sut.Cancel("topic", "invalid")
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should return an error if the message is not delayed", func(t *testing.T) {
+		err := sut.Cancel("topic", immediate.UUID)
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should cancel the message", func(t *testing.T) {
+		err := sut.Cancel("topic", cancelled.UUID)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, immediate, true)
+		assertMessageReceived(t, ch, time.Second, delayed, true)
+
+		select {
+		case m := <-ch:
+			t.Errorf("got %v, expected no message", m)
+			m.Ack()
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("should return an error if the message has been received", func(t *testing.T) {
+		err := sut.Cancel("topic", delayed.UUID)
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+}
+
+func TestPublisher_Reschedule(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer sut.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	exp := newDelayedMessage("payload", time.Hour)
+
+	err = sut.Publish("topic", exp)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should return an error if the message does not exist", func(t *testing.T) {
+		err := sut.Reschedule("topic", "invalid", time.Now())
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should reschedule the message", func(t *testing.T) {
+		dueAt := time.Now().UTC().Add(50 * time.Millisecond)
+
+		err := sut.Reschedule("topic", exp.UUID, dueAt)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		select {
+		case act := <-ch:
+			defer act.Ack()
+
+			assertEqual(t, act.UUID, exp.UUID)
+
+			d, _ := badger.DeliveryInfo(act)
+			assertEqual(t, d.DueAt, dueAt)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	})
+}
+
+func TestPublisher_DueTimePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  badger.DueTimePolicy
+		dueAt   string
+		err     bool
+		receive bool
+	}{
+		{
+			name:  "should reject invalid due times",
+			dueAt: "invalid",
+			err:   true,
+		},
+		{
+			name:   "should reject invalid due times regardless of policy",
+			policy: badger.DueTimeNow,
+			dueAt:  "invalid",
+			err:    true,
+		},
+		{
+			name:  "should reject due times before the minimum by default",
+			dueAt: "1969-12-31T23:59:59Z",
+			err:   true,
+		},
+		{
+			name:  "should reject due times after the maximum by default",
+			dueAt: "2300-01-01T00:00:00Z",
+			err:   true,
+		},
+		{
+			name:    "should clamp due times before the minimum",
+			policy:  badger.DueTimeClamp,
+			dueAt:   "1969-12-31T23:59:59Z",
+			receive: true,
+		},
+		{
+			name:   "should clamp due times after the maximum",
+			policy: badger.DueTimeClamp,
+			dueAt:  "2300-01-01T00:00:00Z",
+		},
+		{
+			name:    "should deliver due times before the minimum now",
+			policy:  badger.DueTimeNow,
+			dueAt:   "1969-12-31T23:59:59Z",
+			receive: true,
+		},
+		{
+			name:    "should deliver due times after the maximum now",
+			policy:  badger.DueTimeNow,
+			dueAt:   "2300-01-01T00:00:00Z",
+			receive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry()
+			defer r.Close()
+
+			sut := badger.NewPublisher(testDB, r, badger.PublisherConfig{DueTimePolicy: tt.policy})
+			defer sut.Close()
+
+			s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+				ReceiveInterval: 10 * time.Millisecond,
+			})
+			defer s.Close()
+
+			ch, err := s.Subscribe(context.Background(), "topic")
+			if !assertNilError(t, err) {
+				return
+			}
+
+			m := newMessage("payload", delay.DelayedUntilKey, tt.dueAt)
+
+			err = sut.Publish("topic", m)
+			if tt.err {
+				if !errors.Is(err, badger.ErrInvalidDueTime) {
+					t.Errorf("got %v, expected %v", err, badger.ErrInvalidDueTime)
+				}
+				return
+			}
+			if !assertNilError(t, err) {
+				return
+			}
+
+			if tt.receive {
+				assertMessageReceived(t, ch, time.Second, m, true)
+				return
+			}
+
+			select {
+			case m := <-ch:
+				t.Errorf("got %v, expected no message", m)
+				m.Ack()
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -106,7 +106,7 @@ func testFanOut(t *testing.T, p message.Publisher, r badger.Registry, l watermil
 	}
 
 	s2 := badger.NewSubscriber(testDB, r, config2)
-	defer s1.Close()
+	defer s2.Close()
 
 	ch2, err := s2.Subscribe(context.Background(), topic)
 	if !assertNilError(t, err) {
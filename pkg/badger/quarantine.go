@@ -0,0 +1,287 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// QuarantinedMessage represents a message that could not be unmarshaled
+	QuarantinedMessage struct {
+		ID          string
+		MessageKey  MessageKey
+		Value       []byte
+		Error       string
+		Quarantined time.Time
+		indexKey    []byte
+	}
+
+	// QuarantineConfig represents quarantine configuration
+	// An empty value is valid, using JSON marshaling by default.
+	// Prefix must match the registry prefix used by the subscriber.
+	QuarantineConfig struct {
+		Prefix    string
+		Marshaler Marshaler
+	}
+
+	// Quarantine provides access to quarantined messages
+	// Messages are quarantined per subscription by the subscriber if their
+	// value cannot be unmarshaled, and can be inspected, fixed and requeued.
+	Quarantine struct {
+		db     *badger.DB
+		config QuarantineConfig
+	}
+
+	// quarantineRecord represents an internal persisted quarantined message for marshaling
+	quarantineRecord struct {
+		MessageKey  []byte    `json:"message_key"`
+		Value       []byte    `json:"value"`
+		Error       string    `json:"error"`
+		Quarantined time.Time `json:"quarantined"`
+		IndexKey    []byte    `json:"index_key,omitempty"`
+	}
+)
+
+// NewQuarantine returns a new quarantine
+func NewQuarantine(db *badger.DB, c QuarantineConfig) *Quarantine {
+	c.setDefaults()
+
+	return &Quarantine{
+		db:     db,
+		config: c,
+	}
+}
+
+// List returns all quarantined messages for the specified subscription in the order they were quarantined
+func (q *Quarantine) List(topic, subscription string) ([]QuarantinedMessage, error) {
+	prefix, err := GenerateQuarantineKeyPrefix(q.config.Prefix, topic, subscription)
+	if err != nil {
+		return nil, err
+	}
+	prefix = append(prefix, '.')
+
+	var messages []QuarantinedMessage
+
+	err = q.db.View(func(tx *badger.Txn) error {
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+
+			// the prefix also matches subscriptions with the same name prefix
+			if bytes.Contains(item.Key()[len(prefix):], []byte(".")) {
+				continue
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			m, err := decodeQuarantineRecord(string(item.Key()[len(prefix):]), value)
+			if err != nil {
+				return err
+			}
+
+			messages = append(messages, m)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Get returns the quarantined message with the specified ID
+// ErrMessageNotFound is returned if the message does not exist.
+func (q *Quarantine) Get(topic, subscription, id string) (QuarantinedMessage, error) {
+	var m QuarantinedMessage
+
+	err := q.db.View(func(tx *badger.Txn) error {
+		var err error
+		_, m, err = q.get(tx, topic, subscription, id)
+		return err
+	})
+
+	return m, err
+}
+
+// Fix replaces the value of the quarantined message with the specified ID
+// The value must be the marshaled message, and is validated when the message is requeued.
+// ErrMessageNotFound is returned if the message does not exist.
+func (q *Quarantine) Fix(topic, subscription, id string, value []byte) error {
+	return q.db.Update(func(tx *badger.Txn) error {
+		key, m, err := q.get(tx, topic, subscription, id)
+		if err != nil {
+			return err
+		}
+
+		m.Value = value
+		return q.set(tx, key, m)
+	})
+}
+
+// Requeue returns the quarantined message with the specified ID to the subscription for immediate delivery
+// The index key is restored if the message was pending, so it can be cancelled or rescheduled.
+// An UnmarshalError is returned if the value still cannot be unmarshaled.
+// ErrMessageNotFound is returned if the message does not exist.
+func (q *Quarantine) Requeue(topic, subscription, id string) error {
+	return q.db.Update(func(tx *badger.Txn) error {
+		key, m, err := q.get(tx, topic, subscription, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err = q.config.Marshaler.Unmarshal(m.Value); err != nil {
+			return &UnmarshalError{Key: m.MessageKey, Err: err}
+		}
+
+		now := time.Now().UTC()
+
+		messageKey, err := m.MessageKey.Update(now)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Set(messageKey, encodeValue(valueHeader{dueAt: now}, m.Value)); err != nil {
+			return fmt.Errorf("failed to write message: %w", err)
+		}
+
+		if m.indexKey != nil {
+			if err = tx.Set(m.indexKey, messageKey); err != nil {
+				return fmt.Errorf("failed to write index: %w", err)
+			}
+		}
+
+		return tx.Delete(key)
+	})
+}
+
+// Delete deletes the quarantined message with the specified ID
+// ErrMessageNotFound is returned if the message does not exist.
+func (q *Quarantine) Delete(topic, subscription, id string) error {
+	return q.db.Update(func(tx *badger.Txn) error {
+		key, _, err := q.get(tx, topic, subscription, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(key)
+	})
+}
+
+func (q *Quarantine) get(tx *badger.Txn, topic, subscription, id string) ([]byte, QuarantinedMessage, error) {
+	// IDs cannot contain separators, which would match other subscriptions
+	if strings.Contains(id, ".") {
+		return nil, QuarantinedMessage{}, ErrMessageNotFound
+	}
+
+	prefix, err := GenerateQuarantineKeyPrefix(q.config.Prefix, topic, subscription)
+	if err != nil {
+		return nil, QuarantinedMessage{}, err
+	}
+
+	key := GenerateQuarantineKey(prefix, id)
+
+	item, err := tx.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, QuarantinedMessage{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, QuarantinedMessage{}, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, QuarantinedMessage{}, err
+	}
+
+	m, err := decodeQuarantineRecord(id, value)
+	if err != nil {
+		return nil, QuarantinedMessage{}, err
+	}
+
+	return key, m, nil
+}
+
+// findIndexKey returns the index key that references the specified message key, or nil if none exists
+// Index entries reference the key written by the publisher, so keys are matched by random ID
+// rather than by value, as the due time is updated when the message is received.
+func findIndexKey(tx *badger.Txn, prefix []byte, key MessageKey) ([]byte, error) {
+	decoded, err := DecodeMessageKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = append(prefix[:len(prefix):len(prefix)], '.')
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		indexed, err := DecodeMessageKey(value)
+		if err == nil && indexed.ID == decoded.ID {
+			return item.KeyCopy(nil), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (q *Quarantine) set(tx *badger.Txn, key []byte, m QuarantinedMessage) error {
+	value, err := encodeQuarantineRecord(m)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(key, value)
+}
+
+func encodeQuarantineRecord(m QuarantinedMessage) ([]byte, error) {
+	return json.Marshal(quarantineRecord{
+		MessageKey:  m.MessageKey,
+		Value:       m.Value,
+		Error:       m.Error,
+		Quarantined: m.Quarantined,
+		IndexKey:    m.indexKey,
+	})
+}
+
+func decodeQuarantineRecord(id string, value []byte) (QuarantinedMessage, error) {
+	var r quarantineRecord
+	if err := json.Unmarshal(value, &r); err != nil {
+		return QuarantinedMessage{}, fmt.Errorf("failed to unmarshal quarantine record: %w", err)
+	}
+
+	return QuarantinedMessage{
+		ID:          id,
+		MessageKey:  r.MessageKey,
+		Value:       r.Value,
+		Error:       r.Error,
+		Quarantined: r.Quarantined,
+		indexKey:    r.IndexKey,
+	}, nil
+}
+
+func (c *QuarantineConfig) setDefaults() {
+	if c.Marshaler == nil {
+		c.Marshaler = JSONMarshaler{}
+	}
+}
@@ -0,0 +1,236 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestQuarantine(t *testing.T) {
+	prefix := uuid.NewString()
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		Name:            "sub",
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	exp := newMessage("payload")
+	err = badger.NewPublisher(testDB, r, badger.PublisherConfig{Marshaler: corruptMarshaler{}}).Publish("topic", exp)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	sut := badger.NewQuarantine(testDB, badger.QuarantineConfig{Prefix: prefix})
+
+	var quarantined []badger.QuarantinedMessage
+	for start := time.Now(); len(quarantined) < 1 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+
+		quarantined, err = sut.List("topic", "sub")
+		if !assertNilError(t, err) {
+			return
+		}
+	}
+
+	t.Run("should list quarantined messages", func(t *testing.T) {
+		if len(quarantined) != 1 {
+			t.Fatalf("got %d quarantined messages, expected 1", len(quarantined))
+		}
+
+		m := quarantined[0]
+		assertEqual(t, string(m.Value), "{")
+		assertEqual(t, m.Error != "", true)
+
+		_, err := m.MessageKey.DueAt()
+		assertNilError(t, err)
+	})
+
+	t.Run("should not list messages for other subscriptions", func(t *testing.T) {
+		other, err := badger.GenerateQuarantineKeyPrefix(prefix, "topic", "sub.x")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = testDB.Update(func(tx *badgerdb.Txn) error {
+			return tx.Set(badger.GenerateQuarantineKey(other, "id"), []byte("{}"))
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		messages, err := sut.List("topic", "sub")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, len(messages), 1)
+
+		_, err = sut.Get("topic", "sub", "x.id")
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should return an error if the message does not exist", func(t *testing.T) {
+		_, err := sut.Get("topic", "sub", "invalid")
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should not requeue messages that cannot be unmarshaled", func(t *testing.T) {
+		var unmarshalErr *badger.UnmarshalError
+		err := sut.Requeue("topic", "sub", quarantined[0].ID)
+		if !errors.As(err, &unmarshalErr) {
+			t.Errorf("got %v, expected %T", err, unmarshalErr)
+		}
+	})
+
+	t.Run("should fix the message", func(t *testing.T) {
+		value, err := badger.JSONMarshaler{}.Marshal(badger.PersistedMessage{
+			UUID:     exp.UUID,
+			Metadata: exp.Metadata,
+			Payload:  exp.Payload,
+			Created:  time.Now().UTC(),
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = sut.Fix("topic", "sub", quarantined[0].ID, value)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		act, err := sut.Get("topic", "sub", quarantined[0].ID)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertDeepEqual(t, act.Value, value)
+	})
+
+	t.Run("should requeue the message", func(t *testing.T) {
+		err := sut.Requeue("topic", "sub", quarantined[0].ID)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, exp, true)
+
+		_, err = sut.Get("topic", "sub", quarantined[0].ID)
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+
+	t.Run("should return an error when deleting requeued messages", func(t *testing.T) {
+		err := sut.Delete("topic", "sub", quarantined[0].ID)
+		if !errors.Is(err, badger.ErrMessageNotFound) {
+			t.Errorf("got %v, expected %v", err, badger.ErrMessageNotFound)
+		}
+	})
+}
+
+func TestQuarantine_Index(t *testing.T) {
+	prefix := uuid.NewString()
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	indexPrefix, err := badger.GenerateIndexKeyPrefix(prefix, "topic", "sub")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	messagePrefix, err := badger.GenerateMessageKeyPrefix(prefix, "topic", "sub")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		Name:            "sub",
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	if _, err = s.Subscribe(context.Background(), "topic"); !assertNilError(t, err) {
+		return
+	}
+
+	exp := newMessage("payload")
+	badger.DelayFor(exp, 50*time.Millisecond)
+
+	err = badger.NewPublisher(testDB, r, badger.PublisherConfig{Marshaler: corruptMarshaler{}}).Publish("topic", exp)
+	if !assertNilError(t, err) {
+		return
+	}
+
+	assertEqual(t, countKeys(t, indexPrefix), 1)
+
+	sut := badger.NewQuarantine(testDB, badger.QuarantineConfig{Prefix: prefix})
+
+	var quarantined []badger.QuarantinedMessage
+	for start := time.Now(); len(quarantined) < 1 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+
+		quarantined, err = sut.List("topic", "sub")
+		if !assertNilError(t, err) {
+			return
+		}
+	}
+	if len(quarantined) != 1 {
+		t.Fatalf("got %d quarantined messages, expected 1", len(quarantined))
+	}
+
+	t.Run("should delete the index key", func(t *testing.T) {
+		assertEqual(t, countKeys(t, indexPrefix), 0)
+	})
+
+	t.Run("should restore the index key when the message is requeued", func(t *testing.T) {
+		assertNilError(t, s.Close())
+
+		value, err := badger.JSONMarshaler{}.Marshal(badger.PersistedMessage{
+			UUID:     exp.UUID,
+			Metadata: exp.Metadata,
+			Payload:  exp.Payload,
+			Created:  time.Now().UTC(),
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		if err = sut.Fix("topic", "sub", quarantined[0].ID, value); !assertNilError(t, err) {
+			return
+		}
+
+		if err = sut.Requeue("topic", "sub", quarantined[0].ID); !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, indexPrefix), 1)
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Cancel("topic", exp.UUID)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, messagePrefix), 0)
+		assertEqual(t, countKeys(t, indexPrefix), 0)
+	})
+}
@@ -1,9 +1,14 @@
 package badger
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/dgraph-io/badger/v4"
 )
 
@@ -15,9 +20,65 @@ type (
 		Close() error
 	}
 
+	// ConfigurableRegistry represents a registry that supports subscription configuration
+	// It is required for filters, ephemeral subscriptions and start positions, and
+	// is implemented by the registry returned by NewRegistry.
+	ConfigurableRegistry interface {
+		Registry
+		RegisterWithConfig(topic, subscription string, c SubscriptionConfig) (*Subscription, error)
+		Unregister(topic, subscription string) error
+		Groups(topic string) ([]string, error)
+	}
+
 	Subscription struct {
+		// Topic is the topic or topic pattern the subscription was registered with
+		Topic string
+
+		// Name is the subscription name
+		Name string
+
+		// Ephemeral indicates that all subscription keys are deleted when it is unregistered
+		Ephemeral bool
+
 		Sequence         *badger.Sequence
 		MessageKeyPrefix []byte
+		IndexKeyPrefix   []byte
+
+		// QuarantineKeyPrefix is the prefix for messages that could not be unmarshaled
+		QuarantineKeyPrefix []byte
+
+		// BodyKeyPrefix is the prefix for message bodies stored outside of message values
+		// If nil, bodies are written under the publisher prefix.
+		BodyKeyPrefix []byte
+
+		// Filter is the metadata filter for the subscription
+		// If nil, all messages are written for the subscription.
+		Filter Filter
+	}
+
+	// SubscriptionConfig represents subscription configuration
+	// An empty value is valid.
+	SubscriptionConfig struct {
+		Filter Filter
+
+		// Group is the consumer group for the subscription
+		// If empty, the subscriber consumer group is used.
+		Group string
+
+		// Start is the position in the topic log that a new consumer group
+		// is seeded from. It has no effect if the group has been registered
+		// before. If StartNew, only messages published after registration are received.
+		Start StartPosition
+
+		// Ephemeral specifies that the subscription and all of its keys are
+		// deleted when the subscriber closes. Leftover ephemeral subscriptions
+		// from processes that did not close cleanly are deleted by the Janitor.
+		Ephemeral bool
+
+		// IdleTimeout specifies the duration after which an ephemeral
+		// subscription that has not received any messages is deleted
+		// If zero, ephemeral subscriptions are deleted only when the subscriber closes.
+		IdleTimeout time.Duration
 	}
 
 	// RegistryConfig represents registry configuration
@@ -25,19 +86,34 @@ type (
 	RegistryConfig struct {
 		Prefix            string
 		SequenceBandwidth uint64
+
+		// HeartbeatInterval is the interval at which ephemeral subscription
+		// markers are refreshed, indicating to janitors in any process that
+		// the subscriptions are live. Defaults to 10 seconds.
+		HeartbeatInterval time.Duration
+		Logger            watermill.LoggerAdapter
+	}
+
+	// groupRecord represents an internal persisted consumer group for marshaling
+	groupRecord struct {
+		Topic string `json:"topic"`
+		Group string `json:"group"`
 	}
 
 	registry struct {
 		db            *badger.DB
 		registrations map[string]map[string]struct{}
 		subscriptions map[string][]*Subscription
+		patterns      []string
 		config        RegistryConfig
 		mu            sync.RWMutex
+		quit          chan struct{}
+		wg            sync.WaitGroup
 	}
 )
 
 // NewRegistry returns a new registry
-func NewRegistry(db *badger.DB, c RegistryConfig) Registry {
+func NewRegistry(db *badger.DB, c RegistryConfig) ConfigurableRegistry {
 	c.setDefaults()
 
 	return &registry{
@@ -51,47 +127,164 @@ func NewRegistry(db *badger.DB, c RegistryConfig) Registry {
 // Register registers the specified topic/subscription combination
 // An error will be returned if the registration already exists.
 func (r *registry) Register(topic string, subscription string) (*Subscription, error) {
+	return r.RegisterWithConfig(topic, subscription, SubscriptionConfig{})
+}
+
+// RegisterWithConfig registers the specified topic/subscription combination using the specified config
+// An error will be returned if the registration already exists.
+func (r *registry) RegisterWithConfig(topic string, subscription string, c SubscriptionConfig) (*Subscription, error) {
 	if topic == "" {
-		return nil, errEmptyTopic
+		return nil, ErrEmptyTopic
 	}
 
+	if err := validateTopicPattern(topic); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	_, topicExists := r.registrations[topic]
 	if topicExists {
 		if _, prefixExists := r.registrations[topic][subscription]; prefixExists {
-			return nil, errors.New("registration already exists")
+			return nil, ErrRegistrationExists
 		}
 	}
 
-	s, err := r.newSubscription(topic, subscription)
+	s, err := r.newSubscription(topic, subscription, c)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.Ephemeral {
+		// the marker is written while holding the lock, so the janitor cannot
+		// observe the marker before the subscription is registered
+		if err = writeEphemeralMarker(r.db, r.config.Prefix, s); err != nil {
+			return nil, errors.Join(err, s.Sequence.Release())
+		}
+	} else if err = writeGroupRecord(r.db, r.config.Prefix, s); err != nil {
+		return nil, errors.Join(err, s.Sequence.Release())
+	}
+
 	if topicExists {
 		r.registrations[topic][subscription] = struct{}{}
 	} else {
 		r.registrations[topic] = map[string]struct{}{subscription: {}}
+
+		if IsTopicPattern(topic) {
+			r.patterns = append(r.patterns, topic)
+		}
 	}
 
 	r.subscriptions[topic] = append(r.subscriptions[topic], s)
+
+	if s.Ephemeral && r.quit == nil {
+		r.quit = make(chan struct{})
+		r.wg.Add(1)
+		go r.heartbeat(r.quit)
+	}
+
 	return s, nil
 }
 
+// Unregister removes the specified topic/subscription combination and releases its sequence
+// All keys are deleted for ephemeral subscriptions.
+// ErrRegistrationNotFound is returned if the registration does not exist.
+func (r *registry) Unregister(topic string, subscription string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.registrations[topic][subscription]; !exists {
+		return ErrRegistrationNotFound
+	}
+
+	i := slices.IndexFunc(r.subscriptions[topic], func(s *Subscription) bool {
+		return s.Name == subscription
+	})
+	s := r.subscriptions[topic][i]
+
+	r.subscriptions[topic] = slices.Delete(slices.Clone(r.subscriptions[topic]), i, i+1)
+	delete(r.registrations[topic], subscription)
+
+	if len(r.registrations[topic]) < 1 {
+		delete(r.registrations, topic)
+		delete(r.subscriptions, topic)
+		r.patterns = slices.DeleteFunc(r.patterns, func(p string) bool { return p == topic })
+	}
+
+	err := s.Sequence.Release()
+	if s.Ephemeral {
+		err = errors.Join(err, deleteSubscription(r.db, r.config.Prefix, s))
+	}
+
+	return err
+}
+
 // Subscriptions returns all registered subscriptions for the specified topic
+// Subscriptions registered with topic patterns that match the topic are included.
 func (r *registry) Subscriptions(topic string) ([]*Subscription, error) {
 	if topic == "" {
-		return nil, errEmptyTopic
+		return nil, ErrEmptyTopic
 	}
 
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	subscriptions := r.subscriptions[topic]
+	for _, pattern := range r.patterns {
+		if pattern != topic && MatchTopic(pattern, topic) {
+			subscriptions = append(slices.Clip(subscriptions), r.subscriptions[pattern]...)
+		}
+	}
+
 	return subscriptions, nil
 }
 
+// Groups returns the persisted consumer groups for the specified topic
+// Groups are persisted when durable subscriptions are registered, so groups
+// registered by other processes or before a restart are included.
+func (r *registry) Groups(topic string) ([]string, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	var groups []string
+	err := r.db.View(func(tx *badger.Txn) error {
+		prefix := generateGroupKeyPrefix(r.config.Prefix, topic)
+
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			value, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var g groupRecord
+			if err = json.Unmarshal(value, &g); err != nil {
+				return fmt.Errorf("failed to unmarshal consumer group: %w", err)
+			}
+
+			// topics can contain the key separator, so the prefix can match other topics
+			if g.Topic == topic {
+				groups = append(groups, g.Group)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
 // Close releases all sequences and clears the registrations
 func (r *registry) Close() error {
+	r.stopHeartbeat()
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -107,11 +300,67 @@ func (r *registry) Close() error {
 		delete(r.registrations, topic)
 	}
 
+	r.patterns = nil
+
 	return err
 }
 
-func (r *registry) newSubscription(topic, subscription string) (*Subscription, error) {
-	s := new(Subscription)
+// heartbeat periodically refreshes the markers of registered ephemeral subscriptions
+func (r *registry) heartbeat(quit chan struct{}) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.writeHeartbeats(); err != nil {
+				r.config.Logger.Error("failed to write ephemeral subscription heartbeats", err, nil)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (r *registry) writeHeartbeats() error {
+	// the lock is held so that markers cannot be rewritten after Unregister deletes them
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, subscriptions := range r.subscriptions {
+		for _, s := range subscriptions {
+			if !s.Ephemeral {
+				continue
+			}
+
+			if err := writeEphemeralMarker(r.db, r.config.Prefix, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *registry) stopHeartbeat() {
+	r.mu.Lock()
+	quit := r.quit
+	r.quit = nil
+	r.mu.Unlock()
+
+	if quit != nil {
+		close(quit)
+		r.wg.Wait()
+	}
+}
+
+func (r *registry) newSubscription(topic, subscription string, c SubscriptionConfig) (*Subscription, error) {
+	s, err := generateSubscription(r.config.Prefix, topic, subscription, c)
+	if err != nil {
+		return nil, err
+	}
 
 	sequenceKey, err := GenerateSequenceKey(r.config.Prefix, topic, subscription)
 	if err != nil {
@@ -123,16 +372,88 @@ func (r *registry) newSubscription(topic, subscription string) (*Subscription, e
 		return nil, err
 	}
 
-	s.MessageKeyPrefix, err = GenerateMessageKeyPrefix(r.config.Prefix, topic, subscription)
+	return s, nil
+}
+
+// registerWithConfig registers the subscription using the config if the registry supports it
+// ErrRegistryNotConfigurable is returned if the config requires a ConfigurableRegistry.
+func registerWithConfig(r Registry, topic, subscription string, c SubscriptionConfig) (*Subscription, error) {
+	if cr, ok := r.(ConfigurableRegistry); ok {
+		return cr.RegisterWithConfig(topic, subscription, c)
+	}
+
+	if c.Filter != nil || c.Ephemeral || c.Start.seed {
+		return nil, ErrRegistryNotConfigurable
+	}
+
+	return r.Register(topic, subscription)
+}
+
+// unregister removes the registration if the registry supports it
+func unregister(r Registry, topic, subscription string) error {
+	if cr, ok := r.(ConfigurableRegistry); ok {
+		return cr.Unregister(topic, subscription)
+	}
+
+	return nil
+}
+
+// generateSubscription returns a subscription with the generated key prefixes and no sequence
+func generateSubscription(prefix, topic, subscription string, c SubscriptionConfig) (*Subscription, error) {
+	s := &Subscription{
+		Topic:     topic,
+		Name:      subscription,
+		Ephemeral: c.Ephemeral,
+		Filter:    c.Filter,
+	}
+
+	var err error
+	s.MessageKeyPrefix, err = GenerateMessageKeyPrefix(prefix, topic, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	s.IndexKeyPrefix, err = GenerateIndexKeyPrefix(prefix, topic, subscription)
 	if err != nil {
 		return nil, err
 	}
 
+	s.QuarantineKeyPrefix, err = GenerateQuarantineKeyPrefix(prefix, topic, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	s.BodyKeyPrefix = generateBodyKeyPrefix(prefix)
+
 	return s, nil
 }
 
+func writeGroupRecord(db *badger.DB, prefix string, s *Subscription) error {
+	key, err := GenerateGroupKey(prefix, s.Topic, s.Name)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(groupRecord{Topic: s.Topic, Group: s.Name})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *badger.Txn) error {
+		return tx.Set(key, value)
+	})
+}
+
 func (c *RegistryConfig) setDefaults() {
 	if c.SequenceBandwidth < 1 {
 		c.SequenceBandwidth = 100
 	}
+
+	if c.HeartbeatInterval < 1 {
+		c.HeartbeatInterval = 10 * time.Second
+	}
+
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
 }
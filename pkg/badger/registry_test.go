@@ -1,8 +1,10 @@
 package badger_test
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -123,7 +125,109 @@ func TestInMemoryRegistry_Subscriptions(t *testing.T) {
 	}
 }
 
-func newRegistry() badger.Registry {
+func TestInMemoryRegistry_Groups(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*testing.T, badger.ConfigurableRegistry)
+		topic string
+		exp   []string
+		err   bool
+	}{
+		{
+			name:  "should return an error if the topic is empty",
+			topic: "",
+			err:   true,
+		},
+		{
+			name:  "should return nil if there are no groups",
+			topic: "top",
+		},
+		{
+			name: "should return persisted groups",
+			setup: func(t *testing.T, r badger.ConfigurableRegistry) {
+				for _, group := range []string{"group2", "group1"} {
+					_, err := r.Register("top", group)
+					assertNilError(t, err)
+				}
+			},
+			topic: "top",
+			exp:   []string{"group1", "group2"},
+		},
+		{
+			name: "should not return groups for other topics",
+			setup: func(t *testing.T, r badger.ConfigurableRegistry) {
+				_, err := r.Register("top", "group1")
+				assertNilError(t, err)
+
+				_, err = r.Register("top.sub", "group2")
+				assertNilError(t, err)
+			},
+			topic: "top",
+			exp:   []string{"group1"},
+		},
+		{
+			name: "should not return ephemeral subscriptions",
+			setup: func(t *testing.T, r badger.ConfigurableRegistry) {
+				_, err := r.RegisterWithConfig("top", "group1", badger.SubscriptionConfig{Ephemeral: true})
+				assertNilError(t, err)
+			},
+			topic: "top",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := uuid.NewString()
+
+			if tt.setup != nil {
+				r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+				tt.setup(t, r)
+				assertNilError(t, r.Close())
+			}
+
+			sut := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+			defer sut.Close()
+
+			act, err := sut.Groups(tt.topic)
+			assertErrorExists(t, err, tt.err)
+			if err != nil {
+				return
+			}
+
+			assertDeepEqual(t, act, tt.exp)
+		})
+	}
+}
+
+func TestSubscriber_RegistryNotConfigurable(t *testing.T) {
+	r := &testRegistry{inner: newRegistry()}
+
+	sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond})
+	defer sut.Close()
+
+	t.Run("should subscribe without config", func(t *testing.T) {
+		ch, err := sut.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		exp := newMessage("payload")
+		if err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", exp); !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, exp, true)
+	})
+
+	t.Run("should return an error if the config requires a configurable registry", func(t *testing.T) {
+		_, err := sut.SubscribeWithConfig(context.Background(), "topic2", badger.SubscriptionConfig{Ephemeral: true})
+		if !errors.Is(err, badger.ErrRegistryNotConfigurable) {
+			t.Errorf("got %v, expected %v", err, badger.ErrRegistryNotConfigurable)
+		}
+	})
+}
+
+func newRegistry() badger.ConfigurableRegistry {
 	return badger.NewRegistry(testDB, badger.RegistryConfig{
 		Prefix: uuid.NewString(),
 	})
@@ -0,0 +1,144 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/requestreply"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// RequesterConfig represents requester configuration
+	// An empty value is valid, with replies polled every 10ms by default.
+	RequesterConfig struct {
+		ReplyTopicPrefix string
+		Timeout          time.Duration
+		Publisher        PublisherConfig
+		Subscriber       SubscriberConfig
+	}
+
+	// Requester represents a request/reply client
+	// Requests are published with a correlation ID and reply topic, and an
+	// ephemeral subscription to the reply topic is created for each request.
+	// Metadata keys are compatible with the Watermill requestreply component.
+	Requester struct {
+		db        *badger.DB
+		registry  Registry
+		publisher Publisher
+		config    RequesterConfig
+	}
+)
+
+// ReplyTopicKey is the metadata key containing the topic that replies should be published to
+const ReplyTopicKey = "_watermill_badger_reply_topic"
+
+// NewRequester returns a new requester
+func NewRequester(db *badger.DB, r Registry, c RequesterConfig) *Requester {
+	c.setDefaults()
+
+	return &Requester{
+		db:        db,
+		registry:  r,
+		publisher: NewPublisher(db, r, c.Publisher),
+		config:    c,
+	}
+}
+
+// Request publishes the request to the specified topic and returns the reply
+// A requestreply.ReplyTimeoutError is returned if no reply is received before the
+// timeout, and a requestreply.CommandHandlerError is returned along with the reply
+// if the reply contains a handler error.
+func (r *Requester) Request(ctx context.Context, topic string, m *message.Message) (*message.Message, error) {
+	operationID := watermill.NewUUID()
+	replyTopic := r.config.ReplyTopicPrefix + "." + operationID
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	subscriber := NewSubscriber(r.db, r.registry, r.config.Subscriber)
+	defer subscriber.Close()
+
+	replies, err := subscriber.SubscribeWithConfig(ctx, replyTopic, SubscriptionConfig{Ephemeral: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to reply topic: %w", err)
+	}
+
+	m.Metadata.Set(requestreply.OperationIDMetadataKey, operationID)
+	m.Metadata.Set(ReplyTopicKey, replyTopic)
+
+	start := time.Now()
+	if err = r.publisher.Publish(topic, m); err != nil {
+		return nil, fmt.Errorf("failed to publish request: %w", err)
+	}
+
+	for {
+		select {
+		case reply, ok := <-replies:
+			if !ok {
+				// the reply subscription is deleted once the context is done
+				return nil, requestreply.ReplyTimeoutError{Duration: time.Since(start), Err: ctx.Err()}
+			}
+
+			reply.Ack()
+
+			if reply.Metadata.Get(requestreply.OperationIDMetadataKey) != operationID {
+				continue
+			}
+
+			if reply.Metadata.Get(requestreply.HasErrorMetadataKey) == "1" {
+				err = errors.New(reply.Metadata.Get(requestreply.ErrorMetadataKey))
+				return reply, requestreply.CommandHandlerError{Err: err}
+			}
+
+			return reply, nil
+		case <-ctx.Done():
+			return nil, requestreply.ReplyTimeoutError{Duration: time.Since(start), Err: ctx.Err()}
+		}
+	}
+}
+
+// Reply publishes the reply to the reply topic of the specified request
+// ErrNoReplyTopic is returned if the request does not contain a reply topic.
+func Reply(p message.Publisher, request *message.Message, reply *message.Message) error {
+	replyTopic, err := getReplyTopic(request)
+	if err != nil {
+		return err
+	}
+
+	reply.Metadata.Set(requestreply.OperationIDMetadataKey, request.Metadata.Get(requestreply.OperationIDMetadataKey))
+	return p.Publish(replyTopic, reply)
+}
+
+// GenerateReplyTopic returns the reply topic of the command message
+// It can be used as the GeneratePublishTopic function of a requestreply.PubSubBackend
+// to reply to requests from Requester.
+func GenerateReplyTopic(params requestreply.PubSubBackendPublishParams) (string, error) {
+	return getReplyTopic(params.CommandMessage)
+}
+
+func getReplyTopic(m *message.Message) (string, error) {
+	replyTopic := m.Metadata.Get(ReplyTopicKey)
+	if replyTopic == "" {
+		return "", ErrNoReplyTopic
+	}
+	return replyTopic, nil
+}
+
+func (c *RequesterConfig) setDefaults() {
+	if c.ReplyTopicPrefix == "" {
+		c.ReplyTopicPrefix = "_reply"
+	}
+
+	if c.Timeout < 1 {
+		c.Timeout = 30 * time.Second
+	}
+
+	if c.Subscriber.ReceiveInterval < 1 {
+		c.Subscriber.ReceiveInterval = 10 * time.Millisecond
+	}
+}
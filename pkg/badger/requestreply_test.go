@@ -0,0 +1,125 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/requestreply"
+	"github.com/ThreeDotsLabs/watermill/message"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestRequester_Request(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests, err := s.Subscribe(ctx, "requests")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	backend, err := requestreply.NewPubSubBackend(requestreply.PubSubBackendConfig{
+		Publisher: p,
+		SubscriberConstructor: func(requestreply.PubSubBackendSubscribeParams) (message.Subscriber, error) {
+			return s, nil
+		},
+		GeneratePublishTopic: badger.GenerateReplyTopic,
+		GenerateSubscribeTopic: func(requestreply.PubSubBackendSubscribeParams) (string, error) {
+			return "", nil
+		},
+	}, requestreply.BackendPubsubJSONMarshaler[string]{})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	go func() {
+		for m := range requests {
+			var err error
+			switch string(m.Payload) {
+			case "ping":
+				err = badger.Reply(p, m, newMessage("pong"))
+			case "backend":
+				err = backend.OnCommandProcessed(ctx, requestreply.BackendOnCommandProcessedParams[string]{
+					CommandMessage: m,
+					HandlerResult:  "result",
+				})
+			case "error":
+				err = backend.OnCommandProcessed(ctx, requestreply.BackendOnCommandProcessedParams[string]{
+					CommandMessage: m,
+					HandleErr:      errTest,
+				})
+			default:
+				m.Ack()
+				continue
+			}
+
+			if err != nil && !errors.Is(err, errTest) {
+				t.Error(err)
+			}
+			m.Ack()
+		}
+	}()
+
+	sut := badger.NewRequester(testDB, r, badger.RequesterConfig{Timeout: time.Second})
+
+	t.Run("should return the reply", func(t *testing.T) {
+		reply, err := sut.Request(context.Background(), "requests", newMessage("ping"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, string(reply.Payload), "pong")
+	})
+
+	t.Run("should return requestreply backend replies", func(t *testing.T) {
+		reply, err := sut.Request(context.Background(), "requests", newMessage("backend"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, string(reply.Payload), `"result"`)
+	})
+
+	t.Run("should return handler errors", func(t *testing.T) {
+		_, err := sut.Request(context.Background(), "requests", newMessage("error"))
+
+		var handlerErr requestreply.CommandHandlerError
+		if !errors.As(err, &handlerErr) || handlerErr.Error() != errTest.Error() {
+			t.Errorf("got %v, expected %T", err, handlerErr)
+		}
+	})
+
+	t.Run("should return an error on timeout", func(t *testing.T) {
+		sut := badger.NewRequester(testDB, r, badger.RequesterConfig{Timeout: 50 * time.Millisecond})
+
+		_, err := sut.Request(context.Background(), "requests", newMessage("ignored"))
+
+		var timeoutErr requestreply.ReplyTimeoutError
+		if !errors.As(err, &timeoutErr) {
+			t.Errorf("got %v, expected %T", err, timeoutErr)
+		}
+	})
+}
+
+func TestReply(t *testing.T) {
+	t.Run("should return an error if the request has no reply topic", func(t *testing.T) {
+		err := badger.Reply(nil, newMessage("request"), newMessage("reply"))
+		if !errors.Is(err, badger.ErrNoReplyTopic) {
+			t.Errorf("got %v, expected %v", err, badger.ErrNoReplyTopic)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package badger
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RetryConfig represents transaction conflict retry configuration
+// An empty value is valid, retrying conflicting transactions up to 5 times by default.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// Set to 1 to disable retries.
+	MaxAttempts int
+
+	// InitialInterval is the backoff before the first retry, which is
+	// doubled for each subsequent retry up to MaxInterval
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func (c *RetryConfig) setDefaults() {
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 5
+	}
+
+	if c.InitialInterval < 1 {
+		c.InitialInterval = time.Millisecond
+	}
+
+	if c.MaxInterval < 1 {
+		c.MaxInterval = 100 * time.Millisecond
+	}
+}
+
+// update runs fn in a read-write transaction, retrying if the transaction conflicts
+// fn may be called multiple times, so must not retain state between calls.
+func update(db *badger.DB, c RetryConfig, fn func(*badger.Txn) error) error {
+	return retry(c, func() error {
+		return db.Update(fn)
+	})
+}
+
+// retry calls fn until it returns an error other than badger.ErrConflict, or
+// the maximum number of attempts is reached
+func retry(c RetryConfig, fn func() error) error {
+	interval := c.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, badger.ErrConflict) || attempt >= c.MaxAttempts {
+			return err
+		}
+
+		// jitter prevents conflicting transactions from retrying in lockstep
+		time.Sleep(interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1)))
+		interval = min(interval*2, c.MaxInterval)
+	}
+}
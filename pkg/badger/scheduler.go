@@ -0,0 +1,439 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	// Schedule represents a recurring message schedule
+	// Exactly one of Cron or Interval must be specified.
+	Schedule struct {
+		Name     string
+		Topic    string
+		Cron     string
+		Interval time.Duration
+		Payload  string
+		Metadata message.Metadata
+	}
+
+	// Occurrence represents a single occurrence of a schedule
+	// It is used as the data when executing the schedule payload template.
+	Occurrence struct {
+		Schedule string
+		Time     time.Time
+	}
+
+	// SchedulerConfig represents scheduler configuration
+	// An empty value is valid, using JSON marshaling by default
+	SchedulerConfig struct {
+		Prefix       string
+		PollInterval time.Duration
+		Logger       watermill.LoggerAdapter
+
+		// Publisher is the configuration used to publish occurrences
+		Publisher PublisherConfig
+	}
+
+	// Scheduler represents a recurring message scheduler
+	// Schedule definitions are persisted in Badger and each occurrence is
+	// published as a delayed message. The next occurrence is published in the
+	// same transaction that records the previous occurrence as emitted, which
+	// guarantees at most one message per tick across restarts.
+	Scheduler struct {
+		db       *badger.DB
+		registry Registry
+		config   SchedulerConfig
+		quit     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// persistedSchedule represents an internal persisted schedule for marshaling
+	persistedSchedule struct {
+		Name     string            `json:"name"`
+		Topic    string            `json:"topic"`
+		Cron     string            `json:"cron,omitempty"`
+		Interval time.Duration     `json:"interval,omitempty"`
+		Payload  string            `json:"payload,omitempty"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+		Next     time.Time         `json:"next"`
+		Pending  string            `json:"pending,omitempty"`
+	}
+)
+
+// ScheduleKey is the metadata key containing the name of the schedule that published a message
+const ScheduleKey = "_watermill_badger_schedule"
+
+var errEmptyScheduleName = errors.New("schedule name is an empty string")
+
+// NewScheduler returns a new scheduler
+func NewScheduler(db *badger.DB, r Registry, c SchedulerConfig) *Scheduler {
+	c.setDefaults()
+
+	s := &Scheduler{
+		db:       db,
+		registry: r,
+		config:   c,
+		quit:     make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// Add stores the specified schedule and publishes its first occurrence
+// An existing schedule with the same name will be replaced, and its pending
+// occurrence cancelled.
+func (s *Scheduler) Add(schedule Schedule) error {
+	if err := schedule.validate(); err != nil {
+		return err
+	}
+
+	key, err := GenerateScheduleKey(s.config.Prefix, schedule.Name)
+	if err != nil {
+		return err
+	}
+
+	return update(s.db, s.config.Publisher.Retry, func(tx *badger.Txn) error {
+		if err := s.cancelPending(tx, key); err != nil {
+			return err
+		}
+
+		ps := persistedSchedule{
+			Name:     schedule.Name,
+			Topic:    schedule.Topic,
+			Cron:     schedule.Cron,
+			Interval: schedule.Interval,
+			Payload:  schedule.Payload,
+			Metadata: schedule.Metadata,
+		}
+
+		return s.publishNext(tx, key, ps, time.Now().UTC())
+	})
+}
+
+// Remove removes the specified schedule and cancels its pending occurrence
+// Occurrences that have already been received will still be delivered.
+func (s *Scheduler) Remove(name string) error {
+	key, err := GenerateScheduleKey(s.config.Prefix, name)
+	if err != nil {
+		return err
+	}
+
+	return update(s.db, s.config.Publisher.Retry, func(tx *badger.Txn) error {
+		if err := s.cancelPending(tx, key); err != nil {
+			return err
+		}
+
+		return tx.Delete(key)
+	})
+}
+
+// Schedules returns all stored schedules
+func (s *Scheduler) Schedules() ([]Schedule, error) {
+	var schedules []Schedule
+
+	err := s.db.View(func(tx *badger.Txn) error {
+		return s.iterateSchedules(tx, func(_ []byte, ps persistedSchedule) error {
+			schedules = append(schedules, ps.schedule())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Close stops the scheduler
+func (s *Scheduler) Close() error {
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+		s.wg.Wait()
+	}
+	return nil
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	for {
+		if err := s.publishDue(); err != nil {
+			s.config.Logger.Error("failed to publish scheduled messages", err, nil)
+		}
+
+		select {
+		case <-time.After(s.config.PollInterval):
+			continue
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// publishDue publishes the next occurrence of each due schedule
+// Each schedule is published in a separate transaction, so the number of due
+// schedules is not limited by the transaction size, and a schedule that cannot
+// be published does not prevent others from being published.
+func (s *Scheduler) publishDue() error {
+	now := time.Now().UTC()
+
+	var keys [][]byte
+	err := s.db.View(func(tx *badger.Txn) error {
+		return s.iterateSchedules(tx, func(key []byte, ps persistedSchedule) error {
+			if !ps.Next.After(now) {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, key := range keys {
+		if err = s.publishDueSchedule(key, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// publishDueSchedule publishes the next occurrence of the schedule with the specified key
+// The schedule is read again within the transaction, as it may have been removed
+// or published by another scheduler since it was found to be due.
+func (s *Scheduler) publishDueSchedule(key []byte, now time.Time) error {
+	return update(s.db, s.config.Publisher.Retry, func(tx *badger.Txn) error {
+		ps, err := s.getSchedule(tx, key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if ps.Next.After(now) {
+			return nil
+		}
+
+		if err = s.publishNext(tx, key, ps, now); err != nil {
+			return fmt.Errorf("failed to publish schedule %s: %w", ps.Name, err)
+		}
+
+		s.config.Logger.Debug("published scheduled message", watermill.LogFields{
+			"schedule": ps.Name,
+			"topic":    ps.Topic,
+			"next":     ps.Next,
+		})
+
+		return nil
+	})
+}
+
+func (s *Scheduler) iterateSchedules(tx *badger.Txn, fn func([]byte, persistedSchedule) error) error {
+	prefix := generateScheduleKeyPrefix(s.config.Prefix)
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		var ps persistedSchedule
+		if err = json.Unmarshal(value, &ps); err != nil {
+			return fmt.Errorf("failed to unmarshal schedule: %w", err)
+		}
+
+		if err = fn(item.KeyCopy(nil), ps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) getSchedule(tx *badger.Txn, key []byte) (persistedSchedule, error) {
+	item, err := tx.Get(key)
+	if err != nil {
+		return persistedSchedule{}, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return persistedSchedule{}, err
+	}
+
+	var ps persistedSchedule
+	if err = json.Unmarshal(value, &ps); err != nil {
+		return persistedSchedule{}, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return ps, nil
+}
+
+// cancelPending cancels the pending occurrence of the schedule with the specified key
+// Occurrences that have already been delivered are ignored.
+func (s *Scheduler) cancelPending(tx *badger.Txn, key []byte) error {
+	ps, err := s.getSchedule(tx, key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if ps.Pending == "" {
+		return nil
+	}
+
+	err = NewTxPublisher(tx, s.registry, s.config.Publisher).Cancel(ps.Topic, ps.Pending)
+	if errors.Is(err, ErrMessageNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// publishNext publishes the occurrence following the previous tick and
+// persists the schedule with the new tick in the same transaction
+func (s *Scheduler) publishNext(tx *badger.Txn, key []byte, ps persistedSchedule, now time.Time) error {
+	next, err := ps.schedule().next(ps.Next, now)
+	if err != nil {
+		return err
+	}
+
+	payload, err := ps.schedule().render(Occurrence{Schedule: ps.Name, Time: next})
+	if err != nil {
+		return err
+	}
+
+	m := message.NewMessage(watermill.NewUUID(), payload)
+	for k, v := range ps.Metadata {
+		m.Metadata.Set(k, v)
+	}
+	m.Metadata.Set(ScheduleKey, ps.Name)
+	DelayUntil(m, next)
+
+	publisher := NewTxPublisher(tx, s.registry, s.config.Publisher)
+	if err = publisher.Publish(ps.Topic, m); err != nil {
+		return err
+	}
+
+	ps.Next = next
+	ps.Pending = m.UUID
+	value, err := json.Marshal(ps)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(key, value)
+}
+
+func (s Schedule) validate() error {
+	if s.Name == "" {
+		return errEmptyScheduleName
+	}
+
+	if s.Topic == "" {
+		return ErrEmptyTopic
+	}
+
+	if (s.Cron == "") == (s.Interval < 1) {
+		return errors.New("exactly one of cron or interval must be specified")
+	}
+
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression: %w", err)
+		}
+	}
+
+	if _, err := template.New(s.Name).Parse(s.Payload); err != nil {
+		return fmt.Errorf("invalid payload template: %w", err)
+	}
+
+	return nil
+}
+
+// next returns the first tick after both the previous tick and now
+// Ticks missed while the scheduler was not running are skipped.
+func (s Schedule) next(prev, now time.Time) (time.Time, error) {
+	after := now
+	if prev.After(now) {
+		after = prev
+	}
+
+	if s.Cron != "" {
+		schedule, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return schedule.Next(after).UTC(), nil
+	}
+
+	if prev.IsZero() {
+		return after.Add(s.Interval), nil
+	}
+
+	missed := after.Sub(prev) / s.Interval
+	return prev.Add((missed + 1) * s.Interval), nil
+}
+
+func (s Schedule) render(o Occurrence) (message.Payload, error) {
+	tmpl, err := template.New(s.Name).Parse(s.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, o); err != nil {
+		return nil, fmt.Errorf("failed to execute payload template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (ps persistedSchedule) schedule() Schedule {
+	return Schedule{
+		Name:     ps.Name,
+		Topic:    ps.Topic,
+		Cron:     ps.Cron,
+		Interval: ps.Interval,
+		Payload:  ps.Payload,
+		Metadata: ps.Metadata,
+	}
+}
+
+func (c *SchedulerConfig) setDefaults() {
+	c.Publisher.setDefaults()
+
+	if c.PollInterval < 1 {
+		c.PollInterval = time.Second
+	}
+
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
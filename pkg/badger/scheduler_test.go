@@ -0,0 +1,274 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestScheduler_Add(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule badger.Schedule
+		err      bool
+	}{
+		{
+			name:     "should return an error if the name is empty",
+			schedule: badger.Schedule{Topic: "topic", Interval: time.Second},
+			err:      true,
+		},
+		{
+			name:     "should return an error if the topic is empty",
+			schedule: badger.Schedule{Name: "name", Interval: time.Second},
+			err:      true,
+		},
+		{
+			name:     "should return an error if neither cron or interval are specified",
+			schedule: badger.Schedule{Name: "name", Topic: "topic"},
+			err:      true,
+		},
+		{
+			name:     "should return an error if both cron and interval are specified",
+			schedule: badger.Schedule{Name: "name", Topic: "topic", Cron: "* * * * *", Interval: time.Second},
+			err:      true,
+		},
+		{
+			name:     "should return an error if the cron expression is invalid",
+			schedule: badger.Schedule{Name: "name", Topic: "topic", Cron: "invalid"},
+			err:      true,
+		},
+		{
+			name:     "should return an error if the payload template is invalid",
+			schedule: badger.Schedule{Name: "name", Topic: "topic", Interval: time.Second, Payload: "{{"},
+			err:      true,
+		},
+		{
+			name:     "should add cron schedules",
+			schedule: badger.Schedule{Name: "name", Topic: "topic", Cron: "*/5 * * * *"},
+		},
+		{
+			name:     "should add interval schedules",
+			schedule: badger.Schedule{Name: "name", Topic: "topic", Interval: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry()
+			defer r.Close()
+
+			sut := badger.NewScheduler(testDB, r, badger.SchedulerConfig{Prefix: uuid.NewString()})
+			defer sut.Close()
+
+			err := sut.Add(tt.schedule)
+			assertErrorExists(t, err, tt.err)
+			if err != nil {
+				return
+			}
+
+			schedules, err := sut.Schedules()
+			if !assertNilError(t, err) {
+				return
+			}
+
+			assertDeepEqual(t, schedules, []badger.Schedule{tt.schedule})
+		})
+	}
+
+	t.Run("should cancel the pending occurrence when replacing a schedule", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		s, err := r.Register("topic", "")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		sut := badger.NewScheduler(testDB, r, badger.SchedulerConfig{Prefix: uuid.NewString()})
+		defer sut.Close()
+
+		for i := 0; i < 2; i++ {
+			err = sut.Add(badger.Schedule{Name: "name", Topic: "topic", Interval: time.Hour})
+			if !assertNilError(t, err) {
+				return
+			}
+		}
+
+		assertEqual(t, countKeys(t, s.MessageKeyPrefix), 1)
+	})
+
+	t.Run("should publish occurrences using the publisher config", func(t *testing.T) {
+		prefix := uuid.NewString()
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		sut := badger.NewScheduler(testDB, r, badger.SchedulerConfig{
+			Prefix:    prefix,
+			Publisher: badger.PublisherConfig{TopicLog: l},
+		})
+		defer sut.Close()
+
+		err = sut.Add(badger.Schedule{Name: "name", Topic: "topic", Interval: time.Hour})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		logPrefix, err := badger.GenerateTopicLogKeyPrefix(prefix, "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, logPrefix), 1)
+	})
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	s, err := r.Register("topic", "")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	sut := badger.NewScheduler(testDB, r, badger.SchedulerConfig{Prefix: uuid.NewString()})
+	defer sut.Close()
+
+	err = sut.Add(badger.Schedule{Name: "name", Topic: "topic", Interval: time.Second})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = sut.Remove("name")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	schedules, err := sut.Schedules()
+	if !assertNilError(t, err) {
+		return
+	}
+
+	assertEqual(t, len(schedules), 0)
+	assertEqual(t, countKeys(t, s.MessageKeyPrefix), 0)
+}
+
+func TestScheduler_Publish(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	prefix := uuid.NewString()
+	config := badger.SchedulerConfig{
+		Prefix:       prefix,
+		PollInterval: 10 * time.Millisecond,
+	}
+
+	// schedulers sharing a prefix contend for the same schedules
+	s1 := badger.NewScheduler(testDB, r, config)
+	defer s1.Close()
+
+	s2 := badger.NewScheduler(testDB, r, config)
+	defer s2.Close()
+
+	err = s1.Add(badger.Schedule{
+		Name:     "name",
+		Topic:    "topic",
+		Interval: 100 * time.Millisecond,
+		Payload:  "{{.Schedule}} {{.Time.UnixNano}}",
+		Metadata: message.Metadata{"key": "value"},
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	received := map[string]int{}
+	timeout := time.After(750 * time.Millisecond)
+
+	for done := false; !done; {
+		select {
+		case m := <-ch:
+			received[string(m.Payload)]++
+			assertEqual(t, m.Metadata.Get(badger.ScheduleKey), "name")
+			assertEqual(t, m.Metadata.Get("key"), "value")
+			m.Ack()
+		case <-timeout:
+			done = true
+		}
+	}
+
+	if len(received) < 3 {
+		t.Errorf("got %d occurrences, expected at least 3", len(received))
+	}
+
+	for payload, count := range received {
+		if count > 1 {
+			t.Errorf("got %d messages for occurrence %s, expected 1", count, payload)
+		}
+	}
+}
+
+func TestScheduler_PublishIndependently(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	s, err := r.Register("topic", "")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	prefix := uuid.NewString()
+
+	invalid, err := badger.GenerateScheduleKey(prefix, "invalid")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	err = testDB.Update(func(tx *badgerdb.Txn) error {
+		return tx.Set(invalid, []byte(`{"name":"invalid","topic":"topic","cron":"invalid"}`))
+	})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	sut := badger.NewScheduler(testDB, r, badger.SchedulerConfig{
+		Prefix:       prefix,
+		PollInterval: 10 * time.Millisecond,
+	})
+	defer sut.Close()
+
+	err = sut.Add(badger.Schedule{Name: "valid", Topic: "topic", Interval: 50 * time.Millisecond})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	// the first occurrence is published by add, and subsequent occurrences by the scheduler
+	for start := time.Now(); countKeys(t, s.MessageKeyPrefix) < 2; {
+		if time.Since(start) > time.Second {
+			t.Fatal("timeout waiting for scheduled messages")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,342 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// Shard represents a Badger DB and the registry for that DB
+	Shard struct {
+		DB       *badger.DB
+		Registry Registry
+	}
+
+	// PartitionKeyFunc returns the partition key for the specified message
+	PartitionKeyFunc func(topic string, m *message.Message) string
+
+	// ShardedPublisherConfig represents sharded publisher configuration
+	// An empty value is valid, distributing topics across shards by default.
+	ShardedPublisherConfig struct {
+		Publisher PublisherConfig
+
+		// PartitionKey returns the key used to select the shard for each message
+		// If nil, the topic is used, so all messages for a topic are written to the same shard.
+		PartitionKey PartitionKeyFunc
+
+		// VirtualNodes is the number of points per shard on the hash ring
+		// It must match the subscriber configuration.
+		VirtualNodes int
+	}
+
+	// ShardedPublisher represents a publisher that distributes messages across multiple Badger DBs
+	// Messages are assigned to shards using consistent hashing, so adding a
+	// shard moves only a fraction of topics or partition keys.
+	ShardedPublisher struct {
+		publishers []Publisher
+		ring       hashRing
+		config     ShardedPublisherConfig
+	}
+
+	// ShardedSubscriberConfig represents sharded subscriber configuration
+	// An empty value is valid, subscribing to the shard for each topic by default.
+	ShardedSubscriberConfig struct {
+		Subscriber SubscriberConfig
+
+		// Partitioned specifies that the publisher uses a partition key, so
+		// messages for a topic can be written to any shard. If true, topics
+		// are subscribed to on all shards. Topic patterns are always
+		// subscribed to on all shards, as matching topics can be on any shard.
+		Partitioned bool
+
+		// VirtualNodes is the number of points per shard on the hash ring
+		// It must match the publisher configuration.
+		VirtualNodes int
+	}
+
+	// ShardedSubscriber represents a subscriber that consumes messages from multiple Badger DBs
+	// Messages from each shard are aggregated into a single output channel.
+	ShardedSubscriber struct {
+		subscribers []*Subscriber
+		ring        hashRing
+		config      ShardedSubscriberConfig
+		quit        chan struct{}
+		wg          sync.WaitGroup
+	}
+
+	// hashRing represents a consistent hash ring of shard indexes
+	hashRing struct {
+		points []uint32
+		shards map[uint32]int
+	}
+)
+
+// NewShardedPublisher returns a new sharded publisher
+// Shards must be specified in the same order for publishers and subscribers.
+// ErrNoShards is returned if no shards are specified.
+func NewShardedPublisher(shards []Shard, c ShardedPublisherConfig) (*ShardedPublisher, error) {
+	c.setDefaults()
+
+	if len(shards) < 1 {
+		return nil, ErrNoShards
+	}
+
+	publishers := make([]Publisher, len(shards))
+	for i, shard := range shards {
+		publishers[i] = NewPublisher(shard.DB, shard.Registry, c.Publisher)
+	}
+
+	return &ShardedPublisher{
+		publishers: publishers,
+		ring:       newHashRing(len(shards), c.VirtualNodes),
+		config:     c,
+	}, nil
+}
+
+// Publish publishes the specified messages
+// Messages are written in a single transaction per shard, so a publish
+// that spans multiple shards is not atomic.
+func (p *ShardedPublisher) Publish(topic string, messages ...*message.Message) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+
+	if p.config.PartitionKey == nil {
+		return p.publishers[p.ring.get(topic)].Publish(topic, messages...)
+	}
+
+	partitions := make(map[int][]*message.Message)
+	for _, m := range messages {
+		shard := p.ring.get(p.config.PartitionKey(topic, m))
+		partitions[shard] = append(partitions[shard], m)
+	}
+
+	for shard, partition := range partitions {
+		if err := p.publishers[shard].Publish(topic, partition...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the publisher
+func (p *ShardedPublisher) Close() error {
+	return nil
+}
+
+// NewShardedSubscriber returns a new sharded subscriber
+// Shards must be specified in the same order for publishers and subscribers.
+// ErrNoShards is returned if no shards are specified.
+func NewShardedSubscriber(shards []Shard, c ShardedSubscriberConfig) (*ShardedSubscriber, error) {
+	c.setDefaults()
+
+	if len(shards) < 1 {
+		return nil, ErrNoShards
+	}
+
+	subscribers := make([]*Subscriber, len(shards))
+	for i, shard := range shards {
+		subscribers[i] = NewSubscriber(shard.DB, shard.Registry, c.Subscriber)
+	}
+
+	return &ShardedSubscriber{
+		subscribers: subscribers,
+		ring:        newHashRing(len(shards), c.VirtualNodes),
+		config:      c,
+		quit:        make(chan struct{}),
+	}, nil
+}
+
+// Subscribe creates a subscription to the specified topic
+func (s *ShardedSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.SubscribeWithConfig(ctx, topic, SubscriptionConfig{})
+}
+
+// SubscribeWithConfig creates a subscription to the specified topic using the specified config
+// The output channel is closed once the context is done or the subscriber is closed.
+// If the subscription fails on any shard, then subscriptions on the other shards are unregistered.
+func (s *ShardedSubscriber) SubscribeWithConfig(ctx context.Context, topic string, c SubscriptionConfig) (<-chan *message.Message, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+
+	subscribers := s.subscribers
+	if !s.config.Partitioned && !IsTopicPattern(topic) {
+		subscribers = []*Subscriber{s.subscribers[s.ring.get(topic)]}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	channels := make([]<-chan *message.Message, 0, len(subscribers))
+	for i, subscriber := range subscribers {
+		ch, err := subscriber.SubscribeWithConfig(ctx, topic, c)
+		if err != nil {
+			cancel()
+			return nil, errors.Join(err, unsubscribe(subscribers[:i], topic, c))
+		}
+		channels = append(channels, ch)
+	}
+
+	out := make(chan *message.Message)
+
+	var wg sync.WaitGroup
+	for _, ch := range channels {
+		wg.Add(1)
+		go func(ch <-chan *message.Message) {
+			defer wg.Done()
+			s.forward(ctx, ch, out)
+		}(ch)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// Close closes the subscriber and all shard subscribers
+func (s *ShardedSubscriber) Close() error {
+	select {
+	case <-s.quit:
+		return nil
+	default:
+		close(s.quit)
+		s.wg.Wait()
+	}
+
+	for _, subscriber := range s.subscribers {
+		subscriber.Close()
+	}
+
+	return nil
+}
+
+// forward sends messages from the shard channel to the output channel
+// Messages that cannot be sent are not acked, so are redelivered once
+// their lease expires.
+func (s *ShardedSubscriber) forward(ctx context.Context, in <-chan *message.Message, out chan<- *message.Message) {
+	for {
+		select {
+		case m, ok := <-in:
+			if !ok {
+				return
+			}
+
+			select {
+			case out <- m:
+			case <-ctx.Done():
+				return
+			case <-s.quit:
+				return
+			}
+		case <-ctx.Done():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// unsubscribe unregisters the subscription from each of the specified subscribers
+// Ephemeral subscriptions are unregistered by the subscriber once the context is done,
+// and registrations cannot be removed from registries that are not configurable.
+func unsubscribe(subscribers []*Subscriber, topic string, c SubscriptionConfig) error {
+	if c.Ephemeral {
+		return nil
+	}
+
+	var err error
+	for _, subscriber := range subscribers {
+		err = errors.Join(err, unregister(subscriber.registry, topic, subscriber.consumerGroup(topic, c)))
+	}
+
+	return err
+}
+
+// PartitionByMetadata returns a partition key func that uses the specified metadata value
+// The topic is used for messages that do not contain the metadata key.
+func PartitionByMetadata(key string) PartitionKeyFunc {
+	return func(topic string, m *message.Message) string {
+		if v, ok := m.Metadata[key]; ok {
+			return v
+		}
+		return topic
+	}
+}
+
+func (c *ShardedPublisherConfig) setDefaults() {
+	if c.VirtualNodes < 1 {
+		c.VirtualNodes = 100
+	}
+}
+
+func (c *ShardedSubscriberConfig) setDefaults() {
+	if c.VirtualNodes < 1 {
+		c.VirtualNodes = 100
+	}
+}
+
+func newHashRing(shards, virtualNodes int) hashRing {
+	r := hashRing{
+		points: make([]uint32, 0, shards*virtualNodes),
+		shards: make(map[uint32]int, shards*virtualNodes),
+	}
+
+	for shard := 0; shard < shards; shard++ {
+		for node := 0; node < virtualNodes; node++ {
+			point := hashKey(strconv.Itoa(shard) + "-" + strconv.Itoa(node))
+			if _, exists := r.shards[point]; exists {
+				continue
+			}
+
+			r.points = append(r.points, point)
+			r.shards[point] = shard
+		}
+	}
+
+	slices.Sort(r.points)
+	return r
+}
+
+// get returns the shard index for the specified key
+func (r hashRing) get(key string) int {
+	point := hashKey(key)
+
+	i, _ := slices.BinarySearch(r.points, point)
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.shards[r.points[i]]
+}
+
+// hashKey returns the hash of the specified key
+// FNV-1a does not distribute similar short keys evenly, so the hash is
+// finalized using the MurmurHash3 avalanche function.
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+
+	return x
+}
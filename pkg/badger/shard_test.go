@@ -0,0 +1,267 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestShardedPublisher_Publish(t *testing.T) {
+	t.Run("should distribute topics across shards", func(t *testing.T) {
+		shards := newShards(t, 3)
+
+		sub, err := badger.NewShardedSubscriber(shards, badger.ShardedSubscriberConfig{
+			Subscriber: badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond},
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sub.Close()
+
+		sut, err := badger.NewShardedPublisher(shards, badger.ShardedPublisherConfig{})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sut.Close()
+
+		topics := make([]string, 30)
+		channels := make([]<-chan *message.Message, len(topics))
+		for i := range topics {
+			topics[i] = "topic" + strconv.Itoa(i)
+
+			channels[i], err = sub.Subscribe(context.Background(), topics[i])
+			if !assertNilError(t, err) {
+				return
+			}
+		}
+
+		for i, topic := range topics {
+			exp := newMessage("payload")
+			if err = sut.Publish(topic, exp); !assertNilError(t, err) {
+				return
+			}
+
+			assertMessageReceived(t, channels[i], time.Second, exp, true)
+		}
+
+		for _, shard := range shards {
+			var count int
+			for _, topic := range topics {
+				subscriptions, err := shard.Registry.Subscriptions(topic)
+				if !assertNilError(t, err) {
+					return
+				}
+				count += len(subscriptions)
+			}
+
+			if count < 1 {
+				t.Error("got 0 topics, expected topics on each shard")
+			}
+		}
+	})
+
+	t.Run("should aggregate partitioned messages", func(t *testing.T) {
+		shards := newShards(t, 3)
+
+		sub, err := badger.NewShardedSubscriber(shards, badger.ShardedSubscriberConfig{
+			Subscriber:  badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond},
+			Partitioned: true,
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sub.Close()
+
+		ch, err := sub.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		sut, err := badger.NewShardedPublisher(shards, badger.ShardedPublisherConfig{
+			PartitionKey: badger.PartitionByMetadata("key"),
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sut.Close()
+
+		messages := make([]*message.Message, 30)
+		for i := range messages {
+			messages[i] = newMessage("payload", "key", strconv.Itoa(i))
+		}
+
+		if err = sut.Publish("topic", messages...); !assertNilError(t, err) {
+			return
+		}
+
+		// messages are not deleted until they are acked
+		for _, shard := range shards {
+			subscriptions, err := shard.Registry.Subscriptions("topic")
+			if !assertNilError(t, err) {
+				return
+			}
+
+			if count := countShardKeys(t, shard.DB, subscriptions[0].MessageKeyPrefix); count < 1 {
+				t.Errorf("got %d messages, expected messages on each shard", count)
+			}
+		}
+
+		received := make(map[string]bool)
+		for range messages {
+			select {
+			case m := <-ch:
+				received[m.UUID] = true
+				m.Ack()
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for message")
+			}
+		}
+
+		for _, m := range messages {
+			if !received[m.UUID] {
+				t.Errorf("message %s not received", m.UUID)
+			}
+		}
+	})
+
+	t.Run("should subscribe to topic patterns on all shards", func(t *testing.T) {
+		shards := newShards(t, 4)
+
+		sub, err := badger.NewShardedSubscriber(shards, badger.ShardedSubscriberConfig{
+			Subscriber: badger.SubscriberConfig{ReceiveInterval: 10 * time.Millisecond},
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sub.Close()
+
+		ch, err := sub.Subscribe(context.Background(), "topic.*")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		sut, err := badger.NewShardedPublisher(shards, badger.ShardedPublisherConfig{})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sut.Close()
+
+		for i := 0; i < 6; i++ {
+			topic := "topic." + strconv.Itoa(i)
+
+			m := newMessage("payload")
+			if err = sut.Publish(topic, m); !assertNilError(t, err) {
+				return
+			}
+
+			exp := newMessage("payload", badger.TopicKey, topic)
+			exp.UUID = m.UUID
+			assertMessageReceived(t, ch, time.Second, exp, true)
+		}
+	})
+
+	t.Run("should return an error if there are no shards", func(t *testing.T) {
+		_, err := badger.NewShardedPublisher(nil, badger.ShardedPublisherConfig{})
+		if !errors.Is(err, badger.ErrNoShards) {
+			t.Errorf("got %v, expected %v", err, badger.ErrNoShards)
+		}
+
+		_, err = badger.NewShardedSubscriber(nil, badger.ShardedSubscriberConfig{})
+		if !errors.Is(err, badger.ErrNoShards) {
+			t.Errorf("got %v, expected %v", err, badger.ErrNoShards)
+		}
+	})
+}
+
+func TestShardedSubscriber_Subscribe(t *testing.T) {
+	t.Run("should unregister subscriptions if any shard fails", func(t *testing.T) {
+		shards := newShards(t, 2)
+		shards[1].Registry = &testRegistry{}
+
+		sut, err := badger.NewShardedSubscriber(shards, badger.ShardedSubscriberConfig{Partitioned: true})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sut.Close()
+
+		_, err = sut.Subscribe(context.Background(), "topic")
+		assertErrorExists(t, err, true)
+
+		subscriptions, err := shards[0].Registry.Subscriptions("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, len(subscriptions), 0)
+	})
+}
+
+func TestShardedSubscriber_Close(t *testing.T) {
+	shards := newShards(t, 2)
+
+	sut, err := badger.NewShardedSubscriber(shards, badger.ShardedSubscriberConfig{Partitioned: true})
+	if !assertNilError(t, err) {
+		return
+	}
+
+	ch, err := sut.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	assertNilError(t, sut.Close())
+
+	select {
+	case _, ok := <-ch:
+		assertEqual(t, ok, false)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for channel to close")
+	}
+}
+
+func newShards(t *testing.T, n int) []badger.Shard {
+	shards := make([]badger.Shard, n)
+	for i := range shards {
+		db, err := badgerdb.Open(badgerdb.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := badger.NewRegistry(db, badger.RegistryConfig{})
+		t.Cleanup(func() {
+			r.Close()
+			db.Close()
+		})
+
+		shards[i] = badger.Shard{DB: db, Registry: r}
+	}
+
+	return shards
+}
+
+func countShardKeys(t *testing.T, db *badgerdb.DB, prefix []byte) int {
+	var count int
+
+	err := db.View(func(tx *badgerdb.Txn) error {
+		opts := badgerdb.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			count++
+		}
+		return nil
+	})
+	assertNilError(t, err)
+
+	return count
+}
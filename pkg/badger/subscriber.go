@@ -1,15 +1,23 @@
 package badger
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/delay"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -22,6 +30,38 @@ type (
 		ReceiveBatchSize  int
 		VisibilityTimeout time.Duration
 		Logger            watermill.LoggerAdapter
+
+		// GenerateConsumerGroup returns the consumer group for the specified topic
+		// If nil, Name is used as the consumer group for all topics.
+		GenerateConsumerGroup func(topic string) string
+
+		// TopicLog is the topic log that new subscriptions are seeded from
+		// It is required if a subscription start position is specified.
+		TopicLog *TopicLog
+
+		// PriorityWeights specifies the share of each receive batch that is
+		// reserved for each priority level to prevent starvation.
+		// If empty, batches are filled in strict priority order.
+		PriorityWeights map[Priority]int
+
+		// Metrics is the metrics hook for the subscriber
+		Metrics Metrics
+
+		// StatsInterval is the interval at which queue statistics are
+		// reported to the metrics hook
+		StatsInterval time.Duration
+
+		// StatsScanLimit is the maximum number of keys that are counted when
+		// calculating queue depth, which limits the cost of reporting stats
+		// for subscriptions with large numbers of delayed messages
+		StatsScanLimit int
+
+		// Retry specifies how leases and acks are retried if the transaction
+		// conflicts, which is likely if multiple consumers share a subscription
+		Retry RetryConfig
+
+		TracerProvider trace.TracerProvider
+		Propagator     propagation.TextMapPropagator
 	}
 
 	// Subscriber represents a BadgerDB Watermill publisher
@@ -33,9 +73,25 @@ type (
 		wg       sync.WaitGroup
 	}
 
+	// rawMessage represents a leased message
+	// ref is the shared body reference if the message was published using StorageShared.
 	rawMessage struct {
-		key   []byte
-		value []byte
+		key      []byte
+		value    []byte
+		ref      []byte
+		dueAt    time.Time
+		attempt  uint32
+		deadline time.Time
+	}
+
+	// receivedMessage represents a decoded message awaiting ack or nack
+	receivedMessage struct {
+		message  *message.Message
+		created  time.Time
+		deadline time.Time
+		ackKeys  [][]byte
+		refs     [][]byte
+		span     trace.Span
 	}
 )
 
@@ -53,7 +109,17 @@ func NewSubscriber(db *badger.DB, r Registry, c SubscriberConfig) *Subscriber {
 
 // Subscriber creates a subscription to the specified topic
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	subscription, err := s.registry.Register(topic, s.config.Name)
+	return s.SubscribeWithConfig(ctx, topic, SubscriptionConfig{})
+}
+
+// SubscribeWithGroup creates a subscription to the specified topic for the specified consumer group
+func (s *Subscriber) SubscribeWithGroup(ctx context.Context, topic, group string) (<-chan *message.Message, error) {
+	return s.SubscribeWithConfig(ctx, topic, SubscriptionConfig{Group: group})
+}
+
+// SubscribeWithConfig creates a subscription to the specified topic using the specified config
+func (s *Subscriber) SubscribeWithConfig(ctx context.Context, topic string, c SubscriptionConfig) (<-chan *message.Message, error) {
+	subscription, err := s.register(topic, c)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +127,7 @@ func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *messa
 	ch := make(chan *message.Message)
 
 	s.wg.Add(1)
-	go s.run(ctx, topic, subscription.MessageKeyPrefix, ch)
+	go s.run(ctx, topic, subscription, c, ch)
 
 	return ch, nil
 }
@@ -76,19 +142,39 @@ func (s *Subscriber) Close() error {
 	return nil
 }
 
-func (s *Subscriber) run(ctx context.Context, topic string, prefix []byte, ch chan<- *message.Message) {
+func (s *Subscriber) run(ctx context.Context, topic string, subscription *Subscription, c SubscriptionConfig, ch chan<- *message.Message) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	defer s.wg.Done()
 
+	defer func() {
+		if subscription.Ephemeral {
+			s.unregister(subscription)
+			close(ch)
+		}
+	}()
+
+	var statsAt time.Time
+	credits := make(priorityCredits)
+	receivedAt := time.Now()
 	for {
-		if err := s.receiveMessages(ctx, topic, prefix, ch); err != nil {
+		count, err := s.receiveMessages(ctx, topic, subscription, credits, ch)
+		if err != nil {
 			s.config.Logger.Error("failed to receive messages", err, watermill.LogFields{
 				"topic":        topic,
-				"subscription": s.config.Name,
+				"subscription": subscription.Name,
 			})
 		}
+		if count > 0 {
+			receivedAt = time.Now()
+		}
+
+		statsAt = s.reportStats(topic, subscription, statsAt)
+
+		if isIdle(c, receivedAt) {
+			return
+		}
 
 		select {
 		case <-time.After(s.config.ReceiveInterval):
@@ -101,78 +187,74 @@ func (s *Subscriber) run(ctx context.Context, topic string, prefix []byte, ch ch
 	}
 }
 
-func (s *Subscriber) receiveMessages(ctx context.Context, topic string, prefix []byte, ch chan<- *message.Message) error {
-	messages, err := s.getMessages(prefix)
+// receiveMessages sends received messages to the channel, returning the number received
+func (s *Subscriber) receiveMessages(ctx context.Context, topic string, subscription *Subscription, credits priorityCredits, ch chan<- *message.Message) (int, error) {
+	messages, err := s.getMessages(subscription.MessageKeyPrefix, s.config.ReceiveBatchSize, credits)
 	if err != nil {
-		return fmt.Errorf("failed to get messages: %w", err)
+		return 0, fmt.Errorf("failed to get messages: %w", err)
 	}
 	if len(messages) < 1 {
-		return nil
+		return 0, nil
 	}
 
 	s.config.Logger.Debug("got messages", watermill.LogFields{
 		"topic":        topic,
-		"subscription": s.config.Name,
+		"subscription": subscription.Name,
 		"count":        len(messages),
 	})
 
+	s.recordReceived(topic, subscription.Name, messages)
+
 	for _, message := range messages {
-		if err = s.sendMessage(ctx, ch, message); err != nil {
-			return fmt.Errorf("failed to send message: %w", err)
+		err = s.sendMessage(ctx, ch, topic, subscription, message)
+
+		var unmarshalErr *UnmarshalError
+		if errors.As(err, &unmarshalErr) {
+			err = s.quarantine(topic, subscription, message, unmarshalErr)
+		}
+		if err != nil {
+			return len(messages), fmt.Errorf("failed to send message: %w", err)
 		}
 	}
 
-	return nil
+	return len(messages), nil
 }
 
-func (s *Subscriber) getMessages(prefix []byte) ([]rawMessage, error) {
+// getMessages leases up to batchSize due messages with the specified prefix
+// Priority credits are updated only once the messages have been leased.
+func (s *Subscriber) getMessages(prefix []byte, batchSize int, credits priorityCredits) ([]rawMessage, error) {
 	var messages []rawMessage
+	var next priorityCredits
 	now := time.Now().UTC()
 
-	err := s.db.Update(func(tx *badger.Txn) error {
-		iter := tx.NewIterator(badger.DefaultIteratorOptions)
-		defer iter.Close()
+	err := update(s.db, s.config.Retry, func(tx *badger.Txn) error {
+		// messages leased by a conflicting attempt are discarded
+		messages = nil
+		next = maps.Clone(credits)
 
-		var count int
-		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
-			if !iter.Valid() {
-				break
-			}
-
-			item := iter.Item()
-			key := MessageKey(item.KeyCopy(nil))
+		candidates := make(map[Priority][]MessageKey, len(priorities))
+		available := make(map[Priority]int, len(priorities))
 
-			dueAt, err := key.DueAt()
+		for _, priority := range priorities {
+			keys, err := s.getDueKeys(tx, GeneratePriorityKeyPrefix(prefix, priority), now, batchSize)
 			if err != nil {
 				return err
 			}
-			if dueAt.After(now) {
-				break
-			}
 
-			value, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
-			}
-
-			newKey, err := key.Update(dueAt.Add(s.config.VisibilityTimeout))
-			if err != nil {
-				return err
-			}
-
-			if err := tx.Set(newKey, value); err != nil {
-				return err
-			}
+			candidates[priority] = keys
+			available[priority] = len(keys)
+		}
 
-			if err := tx.Delete(key); err != nil {
-				return err
-			}
+		allocated := allocatePriorities(available, batchSize, s.config.PriorityWeights, next)
 
-			messages = append(messages, rawMessage{key: newKey, value: value})
+		for _, priority := range priorities {
+			for _, key := range candidates[priority][:allocated[priority]] {
+				message, err := s.leaseMessage(tx, key, now)
+				if err != nil {
+					return err
+				}
 
-			count++
-			if count >= s.config.ReceiveBatchSize {
-				break
+				messages = append(messages, message)
 			}
 		}
 
@@ -182,49 +264,451 @@ func (s *Subscriber) getMessages(prefix []byte) ([]rawMessage, error) {
 		return nil, err
 	}
 
+	clear(credits)
+	maps.Copy(credits, next)
+
 	return messages, nil
 }
 
-func (s *Subscriber) sendMessage(ctx context.Context, ch chan<- *message.Message, rawMessage rawMessage) error {
+// getDueKeys returns up to limit keys in the priority prefix that are due at the specified time
+// Only keys are iterated, and as keys are ordered by due time the scan stops at
+// the first key that is not below the due time bound.
+func (s *Subscriber) getDueKeys(tx *badger.Txn, prefix []byte, now time.Time, limit int) ([]MessageKey, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+
+	iter := tx.NewIterator(opts)
+	defer iter.Close()
+
+	bound := generateDueKeyBound(prefix, now)
+
+	var keys []MessageKey
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		key := iter.Item().Key()
+		if bytes.Compare(key, bound) >= 0 {
+			break
+		}
+
+		keys = append(keys, MessageKey(slices.Clone(key)))
+		if len(keys) >= limit {
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+// leaseMessage leases the message with the specified key until the visibility timeout
+// The value is read only once the message has been allocated to a batch, and
+// pointer values are decoded without copying the full value.
+func (s *Subscriber) leaseMessage(tx *badger.Txn, key MessageKey, now time.Time) (rawMessage, error) {
+	item, err := tx.Get(key)
+	if err != nil {
+		return rawMessage{}, err
+	}
+
+	var header valueHeader
+	var data, ref []byte
+	var shared bool
+
+	err = item.Value(func(value []byte) error {
+		if header, ref, shared = decodePointer(value); shared {
+			ref = slices.Clone(ref)
+			return nil
+		}
+
+		header, data = decodeValue(value)
+		data = slices.Clone(data)
+		return nil
+	})
+	if err != nil {
+		return rawMessage{}, err
+	}
+
+	// corrupt values have no header, so the due time is read from the key
+	if header.dueAt.IsZero() {
+		if header.dueAt, err = key.DueAt(); err != nil {
+			return rawMessage{}, err
+		}
+	}
+
+	deadline := now.Add(s.config.VisibilityTimeout)
+
+	newKey, err := key.Update(deadline)
+	if err != nil {
+		return rawMessage{}, err
+	}
+
+	var newValue []byte
+
+	header.attempt++
+	if shared {
+		if data, err = getBody(tx, ref); err != nil {
+			return rawMessage{}, err
+		}
+		newValue = encodePointer(header, ref)
+	} else {
+		newValue = encodeValue(header, data)
+	}
+
+	if err := tx.Set(newKey, newValue); err != nil {
+		return rawMessage{}, err
+	}
+
+	if err := tx.Delete(key); err != nil {
+		return rawMessage{}, err
+	}
+
+	return rawMessage{
+		key:      newKey,
+		value:    data,
+		ref:      ref,
+		dueAt:    header.dueAt,
+		attempt:  header.attempt,
+		deadline: deadline,
+	}, nil
+}
+
+func (s *Subscriber) sendMessage(ctx context.Context, ch chan<- *message.Message, topic string, subscription *Subscription, rawMessage rawMessage) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	persistedMessage, err := s.config.Marshaler.Unmarshal(rawMessage.value)
+	received, err := s.decodeMessage(ctx, topic, subscription, rawMessage)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+		return err
 	}
+	defer func() {
+		endSpan(received.span, err)
+	}()
 
-	message := message.NewMessage(persistedMessage.UUID, persistedMessage.Payload)
-	message.Metadata = persistedMessage.Metadata
-	message.SetContext(ctx)
+	message := received.message
 
 	select {
 	case ch <- message:
 	case <-ctx.Done():
 		return ctx.Err()
 	case <-s.quit:
-		return errors.New("subscriber was closed")
+		return ErrSubscriberClosed
 	}
 
 	select {
 	case <-message.Acked():
-		if err = s.ack(rawMessage.key); err != nil {
-			return fmt.Errorf("failed to ack: %w", err)
+		if err = s.ack(received.ackKeys, received.refs); err != nil {
+			err = fmt.Errorf("failed to ack: %w", err)
+			return err
 		}
+		s.recordResult(topic, subscription.Name, received, true)
 		return nil
 	case <-message.Nacked():
+		s.recordResult(topic, subscription.Name, received, false)
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	case <-s.quit:
-		return errors.New("subscriber was closed")
+		return ErrSubscriberClosed
+	}
+}
+
+// decodeMessage returns the message along with the keys to delete when it is acked
+func (s *Subscriber) decodeMessage(ctx context.Context, topic string, subscription *Subscription, rawMessage rawMessage) (receivedMessage, error) {
+	persistedMessage, err := s.config.Marshaler.Unmarshal(rawMessage.value)
+	if err != nil {
+		return receivedMessage{}, &UnmarshalError{Key: rawMessage.key, Err: err}
+	}
+
+	ctx, span := startReceiveSpan(ctx, s.config.TracerProvider, s.config.Propagator, persistedMessage, topic, subscription.Name, rawMessage.attempt)
+
+	deliveryTopic := topic
+	if t, ok := persistedMessage.Metadata[TopicKey]; ok {
+		deliveryTopic = t
+	}
+
+	ctx = withDelivery(ctx, Delivery{
+		Topic:         deliveryTopic,
+		Subscription:  subscription.Name,
+		Published:     persistedMessage.Created,
+		DueAt:         rawMessage.dueAt,
+		Attempt:       int(rawMessage.attempt),
+		LeaseDeadline: rawMessage.deadline,
+	})
+
+	message := message.NewMessage(persistedMessage.UUID, persistedMessage.Payload)
+	message.Metadata = persistedMessage.Metadata
+	message.SetContext(ctx)
+
+	ackKeys := [][]byte{rawMessage.key}
+	if _, delayed := persistedMessage.Metadata[delay.DelayedUntilKey]; delayed {
+		ackKeys = append(ackKeys, GenerateIndexKey(subscription.IndexKeyPrefix, persistedMessage.UUID))
+	}
+
+	var refs [][]byte
+	if rawMessage.ref != nil {
+		refs = append(refs, rawMessage.ref)
+	}
+
+	return receivedMessage{
+		message:  message,
+		created:  persistedMessage.Created,
+		deadline: rawMessage.deadline,
+		ackKeys:  ackKeys,
+		refs:     refs,
+		span:     span,
+	}, nil
+}
+
+// quarantine moves a message that cannot be unmarshaled to the subscription
+// quarantine prefix to prevent it from being redelivered
+// Quarantine IDs are ULIDs, so records are ordered by the time they were quarantined.
+func (s *Subscriber) quarantine(topic string, subscription *Subscription, rawMessage rawMessage, cause *UnmarshalError) error {
+	err := update(s.db, s.config.Retry, func(tx *badger.Txn) error {
+		// the message UUID is unknown, so the index key is found by message key
+		indexKey, err := findIndexKey(tx, subscription.IndexKeyPrefix, rawMessage.key)
+		if err != nil {
+			return err
+		}
+
+		value, err := encodeQuarantineRecord(QuarantinedMessage{
+			MessageKey:  rawMessage.key,
+			Value:       rawMessage.value,
+			Error:       cause.Err.Error(),
+			Quarantined: time.Now().UTC(),
+			indexKey:    indexKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal quarantine record: %w", err)
+		}
+
+		key := GenerateQuarantineKey(subscription.QuarantineKeyPrefix, watermill.NewULID())
+		if err = tx.Set(key, value); err != nil {
+			return err
+		}
+		if indexKey != nil {
+			if err = tx.Delete(indexKey); err != nil {
+				return err
+			}
+		}
+		if rawMessage.ref != nil {
+			if err = releaseBody(tx, rawMessage.ref); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(rawMessage.key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
 	}
+
+	s.config.Logger.Error("quarantined message", cause, watermill.LogFields{
+		"topic":        topic,
+		"subscription": subscription.Name,
+	})
+
+	return nil
 }
 
-func (s *Subscriber) ack(rawMessageKey []byte) error {
-	return s.db.Update(func(tx *badger.Txn) error {
-		return tx.Delete(rawMessageKey)
+// unregister deletes an ephemeral subscription once the subscriber stops receiving
+func (s *Subscriber) unregister(subscription *Subscription) {
+	if err := unregister(s.registry, subscription.Topic, subscription.Name); err != nil {
+		s.config.Logger.Error("failed to delete ephemeral subscription", err, watermill.LogFields{
+			"topic":        subscription.Topic,
+			"subscription": subscription.Name,
+		})
+	}
+}
+
+// register registers the subscription and seeds new consumer groups from the topic log
+// A log barrier is written after registration, so that publishes that did not
+// observe the registration either commit before the seed snapshot or conflict
+// and are retried. Messages published concurrently with registration may be
+// both seeded and written by the publisher, so they can be delivered twice.
+func (s *Subscriber) register(topic string, c SubscriptionConfig) (*Subscription, error) {
+	group := s.consumerGroup(topic, c)
+
+	if !c.Start.seed {
+		return registerWithConfig(s.registry, topic, group, c)
+	}
+
+	if s.config.TopicLog == nil {
+		return nil, ErrNoTopicLog
+	}
+
+	registry, ok := s.registry.(ConfigurableRegistry)
+	if !ok {
+		return nil, ErrRegistryNotConfigurable
+	}
+
+	groups, err := registry.Groups(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := registry.RegisterWithConfig(topic, group, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(groups, group) {
+		return subscription, nil
+	}
+
+	if err = s.config.TopicLog.barrier(); err != nil {
+		err = fmt.Errorf("failed to write topic log barrier: %w", err)
+		return nil, errors.Join(err, registry.Unregister(topic, group))
+	}
+
+	count, err := s.config.TopicLog.seed(subscription, c.Start, time.Now().UTC(), s.config.Marshaler)
+	if err != nil {
+		err = fmt.Errorf("failed to seed subscription: %w", err)
+		return nil, errors.Join(err, registry.Unregister(topic, group))
+	}
+
+	s.config.Logger.Debug("seeded subscription", watermill.LogFields{
+		"topic":        topic,
+		"subscription": group,
+		"count":        count,
 	})
+
+	return subscription, nil
+}
+
+// consumerGroup returns the consumer group for the specified topic
+func (s *Subscriber) consumerGroup(topic string, c SubscriptionConfig) string {
+	if c.Group != "" {
+		return c.Group
+	}
+
+	if s.config.GenerateConsumerGroup != nil {
+		return s.config.GenerateConsumerGroup(topic)
+	}
+
+	return s.config.Name
+}
+
+// isIdle returns true if the ephemeral subscription idle timeout has elapsed
+func isIdle(c SubscriptionConfig, receivedAt time.Time) bool {
+	return c.Ephemeral && c.IdleTimeout > 0 && time.Since(receivedAt) >= c.IdleTimeout
+}
+
+// ack deletes the message keys along with any shared body references
+// Shared bodies are deleted in a separate transaction once the references
+// have been deleted, so that the last subscription to ack deletes the body.
+func (s *Subscriber) ack(keys, refs [][]byte) error {
+	err := update(s.db, s.config.Retry, func(tx *badger.Txn) error {
+		for _, key := range append(slices.Clip(keys), refs...) {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(refs) < 1 {
+		return err
+	}
+
+	err = update(s.db, s.config.Retry, func(tx *badger.Txn) error {
+		for _, ref := range refs {
+			if err := collectBody(tx, bodyKey(ref)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// orphaned bodies are deleted by the janitor
+		s.config.Logger.Error("failed to delete message bodies", err, nil)
+	}
+
+	return nil
+}
+
+func (s *Subscriber) recordReceived(topic, subscription string, messages []rawMessage) {
+	s.config.Metrics.MessagesReceived(topic, subscription, len(messages))
+
+	for _, message := range messages {
+		if message.attempt > 1 {
+			s.config.Metrics.MessageRedelivered(topic, subscription)
+		}
+	}
+}
+
+func (s *Subscriber) recordResult(topic, subscription string, m receivedMessage, acked bool) {
+	now := time.Now().UTC()
+
+	if now.After(m.deadline) {
+		s.config.Metrics.LeaseExpired(topic, subscription)
+	}
+
+	if acked {
+		s.config.Metrics.MessageAcked(topic, subscription)
+		s.config.Metrics.MessageHandled(topic, subscription, now.Sub(m.created))
+	} else {
+		s.config.Metrics.MessageNacked(topic, subscription)
+		m.span.SetStatus(codes.Error, "message nacked")
+	}
+}
+
+// reportStats reports queue statistics if the stats interval has elapsed
+// since the last report, returning the time of the last report
+func (s *Subscriber) reportStats(topic string, subscription *Subscription, reportedAt time.Time) time.Time {
+	if _, nop := s.config.Metrics.(NopMetrics); nop || time.Since(reportedAt) < s.config.StatsInterval {
+		return reportedAt
+	}
+
+	stats, err := s.getQueueStats(subscription.MessageKeyPrefix)
+	if err != nil {
+		s.config.Logger.Error("failed to get queue stats", err, watermill.LogFields{
+			"topic":        topic,
+			"subscription": subscription.Name,
+		})
+		return reportedAt
+	}
+
+	s.config.Metrics.QueueStats(topic, subscription.Name, stats)
+	return time.Now()
+}
+
+// getQueueStats returns the queue stats for the specified prefix
+// Depth is counted up to the configured scan limit, and the oldest age is
+// read from the first key of each priority level.
+func (s *Subscriber) getQueueStats(prefix []byte) (QueueStats, error) {
+	var stats QueueStats
+	now := time.Now().UTC()
+
+	err := s.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		for _, priority := range priorities {
+			priorityPrefix := GeneratePriorityKeyPrefix(prefix, priority)
+
+			iter.Seek(priorityPrefix)
+			if !iter.ValidForPrefix(priorityPrefix) {
+				continue
+			}
+
+			// keys are ordered by due time, so the first key is the oldest
+			dueAt, err := MessageKey(iter.Item().Key()).DueAt()
+			if err != nil {
+				return err
+			}
+
+			if age := now.Sub(dueAt); age > stats.OldestAge {
+				stats.OldestAge = age
+			}
+
+			for ; iter.ValidForPrefix(priorityPrefix) && stats.Depth < s.config.StatsScanLimit; iter.Next() {
+				stats.Depth++
+			}
+		}
+
+		return nil
+	})
+
+	return stats, err
 }
 
 func (c *SubscriberConfig) setDefaults() {
@@ -232,6 +716,8 @@ func (c *SubscriberConfig) setDefaults() {
 		c.Marshaler = JSONMarshaler{}
 	}
 
+	c.Retry.setDefaults()
+
 	if c.ReceiveInterval < 1 {
 		c.ReceiveInterval = time.Second
 	}
@@ -247,4 +733,24 @@ func (c *SubscriberConfig) setDefaults() {
 	if c.Logger == nil {
 		c.Logger = watermill.NopLogger{}
 	}
+
+	if c.Metrics == nil {
+		c.Metrics = NopMetrics{}
+	}
+
+	if c.StatsInterval < 1 {
+		c.StatsInterval = 10 * time.Second
+	}
+
+	if c.StatsScanLimit < 1 {
+		c.StatsScanLimit = 10_000
+	}
+
+	if c.TracerProvider == nil {
+		c.TracerProvider = otel.GetTracerProvider()
+	}
+
+	if c.Propagator == nil {
+		c.Propagator = otel.GetTextMapPropagator()
+	}
 }
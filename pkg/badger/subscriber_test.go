@@ -2,7 +2,15 @@ package badger_test
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
 
 	"github.com/stevecallear/watermill-badger/pkg/badger"
 )
@@ -20,3 +28,383 @@ func TestSubscriber_Subscribe(t *testing.T) {
 		assertErrorExists(t, err, true)
 	})
 }
+
+func TestSubscriber_Quarantine(t *testing.T) {
+	t.Run("should quarantine messages that cannot be unmarshaled", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval: 10 * time.Millisecond,
+		})
+		defer s.Close()
+
+		ch, err := s.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		subscriptions, err := r.Subscriptions("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{Marshaler: corruptMarshaler{}}).
+			Publish("topic", newMessage("corrupt"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		exp := newMessage("payload")
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", exp)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, exp, true)
+		assertEqual(t, countKeys(t, subscriptions[0].QuarantineKeyPrefix), 1)
+		waitForKeys(t, subscriptions[0].MessageKeyPrefix, 0)
+	})
+}
+
+func TestSubscriber_VisibilityTimeout(t *testing.T) {
+	prefix := uuid.NewString()
+
+	// messages written by earlier versions are overdue and migrated before subscribing
+	if !writeLegacyMessage(t, prefix, time.Now().Add(-time.Hour)) {
+		return
+	}
+
+	// separate registries are used so that each subscriber leases from the same subscription
+	var channels []<-chan *message.Message
+	for i := 0; i < 2; i++ {
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval:   10 * time.Millisecond,
+			VisibilityTimeout: 200 * time.Millisecond,
+		})
+		defer s.Close()
+
+		ch, err := s.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+		channels = append(channels, ch)
+	}
+
+	var received *message.Message
+	select {
+	case received = <-channels[0]:
+	case received = <-channels[1]:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	t.Run("should deliver migrated messages", func(t *testing.T) {
+		d, _ := badger.DeliveryInfo(received)
+		assertEqual(t, d.Attempt, 1)
+	})
+
+	t.Run("should measure the lease from the time the message was leased", func(t *testing.T) {
+		d, _ := badger.DeliveryInfo(received)
+		assertTimeBetween(t, d.LeaseDeadline, time.Now(), time.Now().Add(200*time.Millisecond))
+
+		// the lease has not expired, so the message is not redelivered
+		select {
+		case m := <-channels[0]:
+			t.Errorf("got message %s, expected none", m.UUID)
+		case m := <-channels[1]:
+			t.Errorf("got message %s, expected none", m.UUID)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	received.Nack()
+}
+
+// writeLegacyMessage writes a message with the specified due time using the
+// unversioned key and value layout, and migrates it to the current layout
+func writeLegacyMessage(t *testing.T, prefix string, dueAt time.Time) bool {
+	t.Helper()
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	subscription, err := r.Register("topic", "")
+	if !assertNilError(t, err) {
+		return false
+	}
+
+	m := newMessage("payload")
+	value, err := badger.JSONMarshaler{}.Marshal(badger.PersistedMessage{
+		UUID:     m.UUID,
+		Metadata: m.Metadata,
+		Payload:  m.Payload,
+		Created:  dueAt,
+	})
+	if !assertNilError(t, err) {
+		return false
+	}
+
+	err = testDB.Update(func(tx *badgerdb.Txn) error {
+		return tx.Set(encodeLegacyMessageKey(subscription.MessageKeyPrefix, dueAt, 1), value)
+	})
+	if !assertNilError(t, err) {
+		return false
+	}
+
+	_, err = badger.MigrateMessageKeys(testDB, subscription)
+	return assertNilError(t, err)
+}
+
+func TestSubscriber_SubscribeWithGroup(t *testing.T) {
+	t.Run("should deliver messages to each group", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval: 10 * time.Millisecond,
+		})
+		defer sut.Close()
+
+		var channels []<-chan *message.Message
+		for _, group := range []string{"group1", "group2"} {
+			ch, err := sut.SubscribeWithGroup(context.Background(), "topic", group)
+			if !assertNilError(t, err) {
+				return
+			}
+			channels = append(channels, ch)
+		}
+
+		exp := newMessage("payload")
+		err := badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", exp)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		for _, ch := range channels {
+			assertMessageReceived(t, ch, time.Second, exp, true)
+		}
+
+		groups, err := r.Groups("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertDeepEqual(t, groups, []string{"group1", "group2"})
+	})
+
+	t.Run("should use the generated consumer group", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			Name:            "sub",
+			ReceiveInterval: 10 * time.Millisecond,
+			GenerateConsumerGroup: func(topic string) string {
+				return topic + "_group"
+			},
+		})
+		defer sut.Close()
+
+		ch, err := sut.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{}).Publish("topic", newMessage("payload"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		select {
+		case m := <-ch:
+			d, _ := badger.DeliveryInfo(m)
+			assertEqual(t, d.Subscription, "topic_group")
+			m.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+
+		groups, err := r.Groups("topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertDeepEqual(t, groups, []string{"topic_group"})
+	})
+}
+
+// corruptMarshaler marshals messages to values that cannot be unmarshaled
+type corruptMarshaler struct {
+	badger.JSONMarshaler
+}
+
+func (corruptMarshaler) Marshal(badger.PersistedMessage) ([]byte, error) {
+	return []byte("{"), nil
+}
+
+func TestSubscriber_ConcurrentConsumers(t *testing.T) {
+	const publishers, consumers, count = 4, 4, 250
+
+	prefix := uuid.NewString()
+	logger := watermill.NewCaptureLogger()
+	retry := badger.RetryConfig{MaxAttempts: 50}
+
+	// each consumer uses a separate registry, so that all consumers lease
+	// from the same subscription as if running in separate processes
+	received := make(chan string, publishers*count)
+	for i := 0; i < consumers; i++ {
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval:  time.Millisecond,
+			ReceiveBatchSize: 5,
+			Logger:           logger,
+			Retry:            retry,
+		})
+		defer sut.Close()
+
+		ch, err := sut.Subscribe(context.Background(), "topic")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		go func() {
+			for m := range ch {
+				received <- m.UUID
+				m.Ack()
+			}
+		}()
+	}
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	if _, err := r.Register("topic", ""); !assertNilError(t, err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, publishers*count)
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pub := badger.NewPublisher(testDB, r, badger.PublisherConfig{Retry: retry})
+			for j := 0; j < count; j++ {
+				if err := pub.Publish("topic", newMessage("payload")); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	seen := make(map[string]bool, publishers*count)
+	for i := 0; i < publishers*count; i++ {
+		select {
+		case id := <-received:
+			if seen[id] {
+				t.Errorf("message %s received more than once", id)
+			}
+			seen[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d messages, expected %d", len(seen), publishers*count)
+		}
+	}
+
+	if errs := logger.Captured()[watermill.ErrorLogLevel]; len(errs) > 0 {
+		t.Errorf("got %d errors, expected none: %v", len(errs), errs[0].Err)
+	}
+}
+
+func BenchmarkSubscriber_Receive(b *testing.B) {
+	for _, delayed := range []int{0, 10_000, 100_000, 1_000_000, 2_000_000} {
+		b.Run(strconv.Itoa(delayed), func(b *testing.B) {
+			benchmarkReceive(b, delayed)
+		})
+	}
+}
+
+// benchmarkReceive publishes and receives a single message with the specified number of delayed messages in the subscription
+func benchmarkReceive(b *testing.B, delayed int) {
+	db, err := badgerdb.Open(badgerdb.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	r := badger.NewRegistry(db, badger.RegistryConfig{})
+	defer r.Close()
+
+	sub := badger.NewSubscriber(db, r, badger.SubscriberConfig{ReceiveInterval: time.Microsecond})
+	defer sub.Close()
+
+	ch, err := sub.Subscribe(context.Background(), "topic")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	subscriptions, err := r.Subscriptions("topic")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// delayed messages are written directly, as publishing millions of messages is slow
+	wb := db.NewWriteBatch()
+	dueAt := time.Now().Add(time.Hour)
+	for i := 0; i < delayed; i++ {
+		key, err := badger.EncodeMessageKey(subscriptions[0].MessageKeyPrefix, badger.PriorityNormal, dueAt, uint64(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = wb.Set(key, []byte("payload")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err = wb.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	pub := badger.NewPublisher(db, r, badger.PublisherConfig{})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err = pub.Publish("topic", newMessage("payload")); err != nil {
+			b.Fatal(err)
+		}
+
+		(<-ch).Ack()
+	}
+}
+
+func countKeys(t *testing.T, prefix []byte) int {
+	var count int
+
+	err := testDB.View(func(tx *badgerdb.Txn) error {
+		opts := badgerdb.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			count++
+		}
+		return nil
+	})
+	assertNilError(t, err)
+
+	return count
+}
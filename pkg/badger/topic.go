@@ -0,0 +1,62 @@
+package badger
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// TopicKey is the metadata key containing the topic a message was published to
+	// It is only set for messages received from topic pattern subscriptions.
+	TopicKey = "_watermill_badger_topic"
+
+	topicSeparator      = "."
+	singleTokenWildcard = "*"
+	multiTokenWildcard  = ">"
+)
+
+// IsTopicPattern returns true if the topic contains wildcard tokens
+// Topics are split into tokens using '.'. The '*' token matches exactly one
+// token, and the '>' token matches one or more trailing tokens.
+func IsTopicPattern(topic string) bool {
+	for _, token := range strings.Split(topic, topicSeparator) {
+		if token == singleTokenWildcard || token == multiTokenWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTopic returns true if the topic matches the specified pattern
+func MatchTopic(pattern, topic string) bool {
+	patternTokens := strings.Split(pattern, topicSeparator)
+	topicTokens := strings.Split(topic, topicSeparator)
+
+	for i, token := range patternTokens {
+		if token == multiTokenWildcard {
+			return len(topicTokens) > i
+		}
+
+		if i >= len(topicTokens) {
+			return false
+		}
+
+		if token != singleTokenWildcard && token != topicTokens[i] {
+			return false
+		}
+	}
+
+	return len(topicTokens) == len(patternTokens)
+}
+
+func validateTopicPattern(pattern string) error {
+	tokens := strings.Split(pattern, topicSeparator)
+
+	for i, token := range tokens {
+		if token == multiTokenWildcard && i != len(tokens)-1 {
+			return fmt.Errorf("%w: %s must be the last token", ErrInvalidTopicPattern, multiTokenWildcard)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		exp     bool
+	}{
+		{pattern: "orders.created", topic: "orders.created", exp: true},
+		{pattern: "orders.created", topic: "orders.updated", exp: false},
+		{pattern: "orders.*", topic: "orders.created", exp: true},
+		{pattern: "orders.*", topic: "orders", exp: false},
+		{pattern: "orders.*", topic: "orders.created.eu", exp: false},
+		{pattern: "*.created", topic: "orders.created", exp: true},
+		{pattern: "orders.>", topic: "orders.created", exp: true},
+		{pattern: "orders.>", topic: "orders.created.eu", exp: true},
+		{pattern: "orders.>", topic: "orders", exp: false},
+		{pattern: "orders.*.>", topic: "orders.created.eu", exp: true},
+		{pattern: "orders.*.>", topic: "orders.created", exp: false},
+		{pattern: "orders*", topic: "orders.created", exp: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.topic, func(t *testing.T) {
+			act := badger.MatchTopic(tt.pattern, tt.topic)
+			assertEqual(t, act, tt.exp)
+		})
+	}
+}
+
+func TestIsTopicPattern(t *testing.T) {
+	assertEqual(t, badger.IsTopicPattern("orders.created"), false)
+	assertEqual(t, badger.IsTopicPattern("orders*"), false)
+	assertEqual(t, badger.IsTopicPattern("orders.*"), true)
+	assertEqual(t, badger.IsTopicPattern("orders.>"), true)
+}
+
+func TestSubscriber_TopicPattern(t *testing.T) {
+	r := newRegistry()
+	defer r.Close()
+
+	t.Run("should return an error if the pattern is invalid", func(t *testing.T) {
+		_, err := r.Register("orders.>.created", "sub")
+		if !errors.Is(err, badger.ErrInvalidTopicPattern) {
+			t.Errorf("got %v, expected %v", err, badger.ErrInvalidTopicPattern)
+		}
+	})
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		ReceiveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	exact, err := s.Subscribe(context.Background(), "orders.created")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	single, err := s.Subscribe(context.Background(), "orders.*")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	multi, err := s.Subscribe(context.Background(), "orders.>")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should deliver messages to matching subscriptions", func(t *testing.T) {
+		m := newMessage("payload")
+		if err := p.Publish("orders.created", m); !assertNilError(t, err) {
+			return
+		}
+
+		exp := newMessage("payload", badger.TopicKey, "orders.created")
+		exp.UUID = m.UUID
+
+		assertMessageReceived(t, exact, time.Second, m, true)
+		assertMessageReceived(t, single, time.Second, exp, true)
+		assertMessageReceived(t, multi, time.Second, exp, true)
+	})
+
+	t.Run("should not deliver messages to non-matching subscriptions", func(t *testing.T) {
+		m := newMessage("payload")
+		if err := p.Publish("orders.created.eu", m); !assertNilError(t, err) {
+			return
+		}
+
+		exp := newMessage("payload", badger.TopicKey, "orders.created.eu")
+		exp.UUID = m.UUID
+
+		select {
+		case act := <-multi:
+			assertMessageEqual(t, act, exp)
+
+			d, _ := badger.DeliveryInfo(act)
+			assertEqual(t, d.Topic, "orders.created.eu")
+			act.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+
+		select {
+		case m := <-single:
+			t.Errorf("got %v, expected no message", m)
+			m.Ack()
+		case m := <-exact:
+			t.Errorf("got %v, expected no message", m)
+			m.Ack()
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
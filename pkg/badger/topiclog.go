@@ -0,0 +1,372 @@
+package badger
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type (
+	// TopicLogConfig represents topic log configuration
+	// An empty value is valid, retaining messages for 24 hours by default.
+	// Prefix must match the registry prefix.
+	TopicLogConfig struct {
+		Prefix    string
+		Retention time.Duration
+
+		// TrimInterval is the interval at which messages older than the
+		// retention period are deleted
+		TrimInterval time.Duration
+
+		SequenceBandwidth uint64
+		Logger            watermill.LoggerAdapter
+	}
+
+	// TopicLog represents a per-topic message log
+	// When configured on a publisher, each published message is written to
+	// the topic log once, regardless of the number of subscriptions. New
+	// subscriptions can then be seeded from the log using a StartPosition.
+	TopicLog struct {
+		db       *badger.DB
+		sequence *badger.Sequence
+		config   TopicLogConfig
+		quit     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// StartPosition represents the position in the topic log that a new subscription starts from
+	// The zero value is StartNew, which receives only messages published after registration.
+	StartPosition struct {
+		at   time.Time
+		seed bool
+	}
+)
+
+var (
+	// StartNew receives only messages published after the subscription is registered
+	StartNew = StartPosition{}
+
+	// StartBeginning seeds the subscription with all retained messages in the topic log
+	StartBeginning = StartPosition{seed: true}
+)
+
+// logKeySuffixLen is the length of the log key following the topic prefix
+// Log keys are encoded as: prefix | published (8) | sequence (8) | priority (1) | due time (8)
+const logKeySuffixLen = 8 + 8 + 1 + 8
+
+// StartAt seeds the subscription with messages in the topic log published at or after the specified time
+func StartAt(t time.Time) StartPosition {
+	return StartPosition{at: t.UTC(), seed: true}
+}
+
+// NewTopicLog returns a new topic log
+// The log is trimmed periodically until it is closed.
+func NewTopicLog(db *badger.DB, c TopicLogConfig) (*TopicLog, error) {
+	c.setDefaults()
+
+	sequence, err := db.GetSequence(generateLogSequenceKey(c.Prefix), c.SequenceBandwidth)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &TopicLog{
+		db:       db,
+		sequence: sequence,
+		config:   c,
+		quit:     make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.run()
+
+	return l, nil
+}
+
+// Trim deletes all messages older than the retention period, returning the number deleted
+func (l *TopicLog) Trim() (int, error) {
+	cutoff := time.Now().UTC().Add(-l.config.Retention)
+
+	wb := l.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var count int
+	err := l.db.View(func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := generateLogKeyPrefix(l.config.Prefix)
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			key := iter.Item().Key()
+			if len(key) < len(prefix)+logKeySuffixLen {
+				continue
+			}
+
+			if !decodeLogKey(key).published.Before(cutoff) {
+				continue
+			}
+
+			if err := wb.Delete(iter.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err = wb.Flush(); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Close stops trimming the log and releases the log sequence
+func (l *TopicLog) Close() error {
+	select {
+	case <-l.quit:
+		return nil
+	default:
+		close(l.quit)
+		l.wg.Wait()
+	}
+	return l.sequence.Release()
+}
+
+func (l *TopicLog) run() {
+	defer l.wg.Done()
+
+	for {
+		count, err := l.Trim()
+		if err != nil {
+			l.config.Logger.Error("failed to trim topic log", err, nil)
+		} else if count > 0 {
+			l.config.Logger.Debug("trimmed topic log", watermill.LogFields{"count": count})
+		}
+
+		select {
+		case <-time.After(l.config.TrimInterval):
+			continue
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// append writes the prepared messages to the topic log within the transaction
+func (l *TopicLog) append(tx *badger.Txn, topic string, messages []preparedMessage, now time.Time) error {
+	prefix, err := GenerateTopicLogKeyPrefix(l.config.Prefix, topic)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		sequence, err := l.sequence.Next()
+		if err != nil {
+			return err
+		}
+
+		key := encodeLogKey(prefix, logKey{
+			published: now,
+			sequence:  sequence,
+			priority:  m.priority,
+			dueAt:     m.dueAt,
+		})
+
+		if err = tx.Set(key, m.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// barrier writes the log barrier key, which is read by every publish to the log
+// Publishes that read the subscriptions before the barrier and commit after it
+// conflict, and are retried with the current subscriptions. As a result a
+// snapshot taken after the barrier contains every message that was not written
+// to subscriptions registered before the barrier.
+func (l *TopicLog) barrier() error {
+	return l.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(generateLogBarrierKey(l.config.Prefix), nil)
+	})
+}
+
+// readBarrier adds the log barrier key to the transaction read set
+func (l *TopicLog) readBarrier(tx *badger.Txn) error {
+	_, err := tx.Get(generateLogBarrierKey(l.config.Prefix))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+// seed writes messages from the topic log published between the start position
+// and the specified time to the subscription, returning the number written
+// Messages are evaluated against the subscription filter, so the marshaler
+// should match the one used by the publisher.
+func (l *TopicLog) seed(s *Subscription, start StartPosition, until time.Time, m Marshaler) (int, error) {
+	if IsTopicPattern(s.Topic) {
+		return 0, fmt.Errorf("%w: start positions are not supported for topic patterns", ErrInvalidTopicPattern)
+	}
+
+	prefix, err := GenerateTopicLogKeyPrefix(l.config.Prefix, s.Topic)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+
+	wb := l.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var count int
+	err = l.db.View(func(tx *badger.Txn) error {
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		seek := prefix
+		if !start.at.IsZero() {
+			seek = encodeLogKey(prefix, logKey{published: start.at})
+		}
+
+		for iter.Seek(seek); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+
+			// topics can contain the key separator, so the prefix can match other topics
+			if len(item.Key()) != len(prefix)+logKeySuffixLen {
+				continue
+			}
+
+			lk := decodeLogKey(item.Key())
+			if !lk.published.Before(until) {
+				break
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			// messages are only unmarshaled if required to evaluate the filter or
+			// index a delayed message. Messages that cannot be unmarshaled are
+			// seeded as-is, and quarantined by the subscriber when received.
+			delayed := lk.dueAt.After(now)
+
+			var uuid string
+			if s.Filter != nil || delayed {
+				_, data := decodeValue(value)
+				if persistedMessage, err := m.Unmarshal(data); err == nil {
+					if s.Filter != nil && !s.Filter.Match(persistedMessage.Metadata) {
+						continue
+					}
+					if delayed {
+						uuid = persistedMessage.UUID
+					}
+				}
+			}
+
+			if err = seedMessage(wb, s, lk, value, uuid); err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err = wb.Flush(); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// seedMessage writes a single topic log message to the subscription
+// If uuid is not empty then the message is indexed as a pending delayed message.
+func seedMessage(wb *badger.WriteBatch, s *Subscription, lk logKey, value []byte, uuid string) error {
+	sequence, err := s.Sequence.Next()
+	if err != nil {
+		return err
+	}
+
+	key, err := EncodeMessageKey(s.MessageKeyPrefix, lk.priority, lk.dueAt, sequence)
+	if err != nil {
+		return err
+	}
+
+	if err = wb.Set(key, value); err != nil {
+		return err
+	}
+
+	if uuid != "" {
+		return wb.Set(GenerateIndexKey(s.IndexKeyPrefix, uuid), key)
+	}
+
+	return nil
+}
+
+func (c *TopicLogConfig) setDefaults() {
+	if c.Retention < 1 {
+		c.Retention = 24 * time.Hour
+	}
+
+	if c.TrimInterval < 1 {
+		c.TrimInterval = time.Minute
+	}
+
+	if c.SequenceBandwidth < 1 {
+		c.SequenceBandwidth = 100
+	}
+
+	if c.Logger == nil {
+		c.Logger = watermill.NopLogger{}
+	}
+}
+
+// logKey represents the components of a topic log key
+type logKey struct {
+	published time.Time
+	sequence  uint64
+	priority  Priority
+	dueAt     time.Time
+}
+
+func encodeLogKey(prefix []byte, k logKey) []byte {
+	n := len(prefix)
+
+	encoded := make([]byte, n+logKeySuffixLen)
+	copy(encoded, prefix)
+	binary.BigEndian.PutUint64(encoded[n:n+8], uint64(k.published.UnixNano()))
+	binary.BigEndian.PutUint64(encoded[n+8:n+16], k.sequence)
+	encoded[n+16] = byte(k.priority)
+	binary.BigEndian.PutUint64(encoded[n+17:n+25], uint64(k.dueAt.UnixNano()))
+
+	return encoded
+}
+
+// decodeLogKey decodes the fixed length suffix of the specified log key
+func decodeLogKey(key []byte) logKey {
+	n := len(key) - logKeySuffixLen
+
+	return logKey{
+		published: time.Unix(0, int64(binary.BigEndian.Uint64(key[n:n+8]))).UTC(),
+		sequence:  binary.BigEndian.Uint64(key[n+8 : n+16]),
+		priority:  Priority(key[n+16]),
+		dueAt:     time.Unix(0, int64(binary.BigEndian.Uint64(key[n+17:n+25]))).UTC(),
+	}
+}
@@ -0,0 +1,283 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	badgerdb "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestSubscriber_StartPosition(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(published []time.Time) badger.StartPosition
+		exp   func(messages []*message.Message) []*message.Message
+	}{
+		{
+			name: "should receive only new messages",
+			start: func([]time.Time) badger.StartPosition {
+				return badger.StartNew
+			},
+			exp: func([]*message.Message) []*message.Message {
+				return nil
+			},
+		},
+		{
+			name: "should seed from the beginning",
+			start: func([]time.Time) badger.StartPosition {
+				return badger.StartBeginning
+			},
+			exp: func(messages []*message.Message) []*message.Message {
+				return messages
+			},
+		},
+		{
+			name: "should seed from the specified time",
+			start: func(published []time.Time) badger.StartPosition {
+				return badger.StartAt(published[1])
+			},
+			exp: func(messages []*message.Message) []*message.Message {
+				return messages[1:]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := uuid.NewString()
+
+			r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+			defer r.Close()
+
+			l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix})
+			if !assertNilError(t, err) {
+				return
+			}
+			defer l.Close()
+
+			pub := badger.NewPublisher(testDB, r, badger.PublisherConfig{TopicLog: l})
+
+			messages := []*message.Message{newMessage("payload1"), newMessage("payload2")}
+			published := make([]time.Time, len(messages))
+			for i, m := range messages {
+				time.Sleep(time.Millisecond)
+				published[i] = time.Now()
+
+				if err = pub.Publish("topic", m); !assertNilError(t, err) {
+					return
+				}
+			}
+
+			sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+				ReceiveInterval: 10 * time.Millisecond,
+				TopicLog:        l,
+			})
+			defer sut.Close()
+
+			ch, err := sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+				Start: tt.start(published),
+			})
+			if !assertNilError(t, err) {
+				return
+			}
+
+			for _, exp := range tt.exp(messages) {
+				assertMessageReceived(t, ch, time.Second, exp, true)
+			}
+
+			exp := newMessage("payload3")
+			if err = pub.Publish("topic", exp); !assertNilError(t, err) {
+				return
+			}
+
+			assertMessageReceived(t, ch, time.Second, exp, true)
+		})
+	}
+
+	t.Run("should not seed existing groups", func(t *testing.T) {
+		prefix := uuid.NewString()
+
+		l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		s, err := r.Register("topic", "group")
+		if !assertNilError(t, err) {
+			return
+		}
+		assertNilError(t, r.Close())
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{TopicLog: l}).Publish("topic", newMessage("payload"))
+		if !assertNilError(t, err) {
+			return
+		}
+
+		r = badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{TopicLog: l})
+		defer sut.Close()
+
+		_, err = sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+			Group: "group",
+			Start: badger.StartBeginning,
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, countKeys(t, s.MessageKeyPrefix), 0)
+	})
+
+	t.Run("should conflict with publishes that do not observe the registration", func(t *testing.T) {
+		prefix := uuid.NewString()
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		tx := testDB.NewTransaction(true)
+		defer tx.Discard()
+
+		m := newMessage("payload")
+		err = badger.NewTxPublisher(tx, r, badger.PublisherConfig{TopicLog: l}).Publish("topic", m)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+			ReceiveInterval: 10 * time.Millisecond,
+			TopicLog:        l,
+		})
+		defer sut.Close()
+
+		ch, err := sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+			Start: badger.StartBeginning,
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+
+		if err = tx.Commit(); !errors.Is(err, badgerdb.ErrConflict) {
+			t.Fatalf("got %v, expected %v", err, badgerdb.ErrConflict)
+		}
+
+		err = badger.NewPublisher(testDB, r, badger.PublisherConfig{TopicLog: l}).Publish("topic", m)
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertMessageReceived(t, ch, time.Second, m, true)
+	})
+
+	t.Run("should return an error if the topic log is not configured", func(t *testing.T) {
+		r := newRegistry()
+		defer r.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{})
+		defer sut.Close()
+
+		_, err := sut.SubscribeWithConfig(context.Background(), "topic", badger.SubscriptionConfig{
+			Start: badger.StartBeginning,
+		})
+		if !errors.Is(err, badger.ErrNoTopicLog) {
+			t.Errorf("got %v, expected %v", err, badger.ErrNoTopicLog)
+		}
+	})
+
+	t.Run("should return an error if the topic is a pattern", func(t *testing.T) {
+		prefix := uuid.NewString()
+
+		r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+		defer r.Close()
+
+		l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer l.Close()
+
+		sut := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{TopicLog: l})
+		defer sut.Close()
+
+		_, err = sut.SubscribeWithConfig(context.Background(), "topic.*", badger.SubscriptionConfig{
+			Start: badger.StartBeginning,
+		})
+		if !errors.Is(err, badger.ErrInvalidTopicPattern) {
+			t.Errorf("got %v, expected %v", err, badger.ErrInvalidTopicPattern)
+		}
+
+		subscriptions, err := r.Subscriptions("topic.a")
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, len(subscriptions), 0)
+	})
+}
+
+func TestTopicLog_Trim(t *testing.T) {
+	prefix := uuid.NewString()
+
+	r := badger.NewRegistry(testDB, badger.RegistryConfig{Prefix: prefix})
+	defer r.Close()
+
+	l, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{Prefix: prefix, TrimInterval: time.Hour})
+	if !assertNilError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	err = badger.NewPublisher(testDB, r, badger.PublisherConfig{TopicLog: l}).Publish("topic", newMessage("payload"))
+	if !assertNilError(t, err) {
+		return
+	}
+
+	logPrefix, err := badger.GenerateTopicLogKeyPrefix(prefix, "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	t.Run("should retain messages within the retention period", func(t *testing.T) {
+		count, err := l.Trim()
+		if !assertNilError(t, err) {
+			return
+		}
+
+		assertEqual(t, count, 0)
+		assertEqual(t, countKeys(t, logPrefix), 1)
+	})
+
+	t.Run("should delete messages outside of the retention period", func(t *testing.T) {
+		sut, err := badger.NewTopicLog(testDB, badger.TopicLogConfig{
+			Prefix:       prefix,
+			Retention:    time.Nanosecond,
+			TrimInterval: 10 * time.Millisecond,
+		})
+		if !assertNilError(t, err) {
+			return
+		}
+		defer sut.Close()
+
+		for start := time.Now(); countKeys(t, logPrefix) > 0; {
+			if time.Since(start) > time.Second {
+				t.Fatal("timeout waiting for topic log to be trimmed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
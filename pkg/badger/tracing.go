@@ -0,0 +1,83 @@
+package badger
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/delay"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/stevecallear/watermill-badger"
+
+	messagingSystem = "badger"
+)
+
+// Span attribute keys
+const (
+	AttributeKeyAttempt = attribute.Key("messaging.badger.attempt")
+	AttributeKeyDelay   = attribute.Key("messaging.badger.delay")
+)
+
+func startPublishSpan(tp trace.TracerProvider, m *message.Message, topic string, delay time.Duration) (context.Context, trace.Span) {
+	return tp.Tracer(tracerName).Start(m.Context(), topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", messagingSystem),
+			attribute.String("messaging.operation", "publish"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("messaging.message.id", m.UUID),
+			AttributeKeyDelay.Int64(delay.Milliseconds()),
+		),
+	)
+}
+
+func startReceiveSpan(ctx context.Context, tp trace.TracerProvider, p propagation.TextMapPropagator, pm PersistedMessage, topic, subscription string, attempt uint32) (context.Context, trace.Span) {
+	ctx = p.Extract(ctx, propagation.MapCarrier(pm.Metadata))
+
+	return tp.Tracer(tracerName).Start(ctx, topic+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", messagingSystem),
+			attribute.String("messaging.operation", "receive"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("messaging.destination.subscription.name", subscription),
+			attribute.String("messaging.message.id", pm.UUID),
+			AttributeKeyAttempt.Int64(int64(attempt)),
+			AttributeKeyDelay.Int64(getDelay(pm).Milliseconds()),
+		),
+	)
+}
+
+// injectTraceContext returns a copy of the metadata containing the trace context
+func injectTraceContext(ctx context.Context, p propagation.TextMapPropagator, md message.Metadata) message.Metadata {
+	injected := make(message.Metadata, len(md))
+	for k, v := range md {
+		injected[k] = v
+	}
+
+	p.Inject(ctx, propagation.MapCarrier(injected))
+	return injected
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// getDelay returns the publish delay of the persisted message
+func getDelay(pm PersistedMessage) time.Duration {
+	until, err := time.Parse(time.RFC3339Nano, pm.Metadata.Get(delay.DelayedUntilKey))
+	if err != nil || until.Before(pm.Created) {
+		return 0
+	}
+	return until.Sub(pm.Created)
+}
@@ -0,0 +1,123 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	propagator := propagation.TraceContext{}
+
+	r := newRegistry()
+	defer r.Close()
+
+	p := badger.NewPublisher(testDB, r, badger.PublisherConfig{
+		TracerProvider: provider,
+		Propagator:     propagator,
+	})
+	defer p.Close()
+
+	s := badger.NewSubscriber(testDB, r, badger.SubscriberConfig{
+		Name:              "sub",
+		ReceiveInterval:   10 * time.Millisecond,
+		VisibilityTimeout: 20 * time.Millisecond,
+		TracerProvider:    provider,
+		Propagator:        propagator,
+	})
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), "topic")
+	if !assertNilError(t, err) {
+		return
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	exp := newMessage("payload")
+	exp.SetContext(ctx)
+
+	err = p.Publish("topic", exp)
+	parent.End()
+	if !assertNilError(t, err) {
+		return
+	}
+
+	var consumerCtx trace.SpanContext
+	for _, ack := range []bool{false, true} {
+		select {
+		case m := <-ch:
+			consumerCtx = trace.SpanContextFromContext(m.Context())
+			if ack {
+				m.Ack()
+			} else {
+				m.Nack()
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+
+	// wait for the consumer span to end after the ack
+	var spans tracetest.SpanStubs
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if spans = exporter.GetSpans(); len(spans) >= 4 {
+			break
+		}
+	}
+
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+
+	producers, consumers := byName["topic publish"], byName["topic receive"]
+	assertEqual(t, len(producers), 1)
+	assertEqual(t, len(consumers), 2)
+	if len(producers) != 1 || len(consumers) != 2 {
+		return
+	}
+
+	t.Run("should create a producer span as a child of the message context", func(t *testing.T) {
+		act := producers[0]
+		assertEqual(t, act.SpanKind, trace.SpanKindProducer)
+		assertEqual(t, act.Parent.SpanID(), parent.SpanContext().SpanID())
+		assertAttribute(t, act.Attributes, "messaging.destination.name", attribute.StringValue("topic"))
+	})
+
+	t.Run("should create consumer spans linked to the producer span", func(t *testing.T) {
+		for i, act := range consumers {
+			assertEqual(t, act.SpanKind, trace.SpanKindConsumer)
+			assertEqual(t, act.Parent.SpanID(), producers[0].SpanContext.SpanID())
+			assertAttribute(t, act.Attributes, "messaging.destination.subscription.name", attribute.StringValue("sub"))
+			assertAttribute(t, act.Attributes, badger.AttributeKeyAttempt, attribute.Int64Value(int64(i+1)))
+		}
+	})
+
+	t.Run("should set the consumer span in the message context", func(t *testing.T) {
+		assertEqual(t, consumerCtx.SpanID(), consumers[1].SpanContext.SpanID())
+	})
+}
+
+func assertAttribute(t *testing.T, attrs []attribute.KeyValue, key attribute.Key, exp attribute.Value) {
+	t.Helper()
+
+	for _, attr := range attrs {
+		if attr.Key == key {
+			assertEqual(t, attr.Value, exp)
+			return
+		}
+	}
+
+	t.Errorf("attribute %s not found", key)
+}
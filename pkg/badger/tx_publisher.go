@@ -1,17 +1,38 @@
 package badger
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/components/delay"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// preparedMessage represents a marshaled message ready to be written
+// patternValue contains the topic metadata for topic pattern subscriptions.
+// body, patternBody and refs track the shared bodies written for the message.
+type preparedMessage struct {
+	uuid         string
+	metadata     message.Metadata
+	value        []byte
+	patternValue []byte
+	dueAt        time.Time
+	priority     Priority
+	body         []byte
+	patternBody  []byte
+	refs         int
+}
+
 // TxPublisher represents a BadgerDB Watermill publisher
 // TxPublisher would be typically be used in scenarios where messages must
 // be published within a pre-existing transaction as part of an outbox pattern.
+// If a topic log is configured, transactions conflict with subscriptions that
+// are seeded concurrently, and should be retried if badger.ErrConflict is returned.
 type TxPublisher struct {
 	tx       *badger.Txn
 	registry Registry
@@ -30,61 +51,318 @@ func NewTxPublisher(tx *badger.Txn, r Registry, c PublisherConfig) TxPublisher {
 }
 
 // Publish publishes the specified messages
-func (p TxPublisher) Publish(topic string, messages ...*message.Message) error {
+func (p TxPublisher) Publish(topic string, messages ...*message.Message) (err error) {
 	if topic == "" {
-		return errEmptyTopic
+		return ErrEmptyTopic
 	}
 
 	if len(messages) < 1 {
 		return nil
 	}
 
+	// the publish time is taken before subscriptions are retrieved, and the log
+	// barrier is read, so that subscriptions seeded from the topic log either
+	// observe the message in the log or are returned by the registry
+	now := time.Now().UTC()
+
+	if p.config.TopicLog != nil {
+		if err = p.config.TopicLog.readBarrier(p.tx); err != nil {
+			return fmt.Errorf("failed to read topic log barrier: %w", err)
+		}
+	}
+
 	subscriptions, err := p.registry.Subscriptions(topic)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve subscriptions: %w", err)
 	}
 
-	if len(subscriptions) < 1 {
+	if len(subscriptions) < 1 && p.config.TopicLog == nil {
 		return nil
 	}
 
-	now := time.Now().UTC()
+	spans := make([]trace.Span, 0, len(messages))
+	defer func() {
+		for _, span := range spans {
+			endSpan(span, err)
+		}
+	}()
+
+	patterned := slices.ContainsFunc(subscriptions, func(s *Subscription) bool {
+		return IsTopicPattern(s.Topic)
+	})
+
+	prepared := make([]preparedMessage, len(messages))
+	for i, message := range messages {
+		var span trace.Span
+		prepared[i], span, err = p.prepareMessage(topic, message, now, patterned)
+		if span != nil {
+			spans = append(spans, span)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.config.TopicLog != nil {
+		if err = p.config.TopicLog.append(p.tx, topic, prepared, now); err != nil {
+			return p.wrapError(topic, "failed to write topic log", err)
+		}
+	}
 
 	for _, subscription := range subscriptions {
-		for _, message := range messages {
+		for i := range prepared {
+			message := &prepared[i]
+
+			if subscription.Filter != nil && !subscription.Filter.Match(message.metadata) {
+				continue
+			}
+
 			sequence, err := subscription.Sequence.Next()
 			if err != nil {
 				return err
 			}
 
-			value, err := p.marshalMessage(message, now)
+			key, err := EncodeMessageKey(subscription.MessageKeyPrefix, message.priority, message.dueAt, sequence)
 			if err != nil {
-				return fmt.Errorf("failed to marshal message: %w", err)
+				return err
 			}
 
-			dueAt, err := p.getDueAt(message, now)
+			value, err := p.subscriptionValue(message, subscription)
 			if err != nil {
-				return fmt.Errorf("failed to parse delay: %w", err)
+				return p.wrapError(topic, "failed to write message body", err)
 			}
 
-			key := EncodeMessageKey(subscription.MessageKeyPrefix, dueAt, sequence)
 			if err = p.tx.Set(key, value); err != nil {
-				return fmt.Errorf("failed to write message: %w", err)
+				return p.wrapError(topic, "failed to write message", err)
+			}
+
+			if message.dueAt.After(now) {
+				indexKey := GenerateIndexKey(subscription.IndexKeyPrefix, message.uuid)
+				if err = p.tx.Set(indexKey, key); err != nil {
+					return p.wrapError(topic, "failed to write index", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Cancel deletes the pending delayed message with the specified UUID from all topic subscriptions
+// ErrMessageNotFound is returned if no pending message exists.
+func (p TxPublisher) Cancel(topic string, uuid string) error {
+	return p.updatePending(topic, uuid, func(key MessageKey, value []byte) (MessageKey, error) {
+		if _, ref, ok := decodePointer(value); ok {
+			if err := releaseBody(p.tx, ref); err != nil {
+				return nil, err
 			}
 		}
+		return nil, p.tx.Delete(key)
+	})
+}
+
+// Reschedule updates the due time of the pending delayed message with the specified UUID in all topic subscriptions
+// Out of range due times are handled according to the configured DueTimePolicy.
+// ErrMessageNotFound is returned if no pending message exists.
+func (p TxPublisher) Reschedule(topic string, uuid string, dueAt time.Time) error {
+	dueAt, err := p.config.DueTimePolicy.apply(dueAt.UTC(), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return p.updatePending(topic, uuid, func(key MessageKey, value []byte) (MessageKey, error) {
+		newKey, err := key.Update(dueAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = p.tx.Set(newKey, updateValueDueAt(value, dueAt)); err != nil {
+			return nil, err
+		}
+
+		return newKey, p.tx.Delete(key)
+	})
+}
+
+// updatePending applies fn to each pending message with the specified UUID
+// The index is updated with the returned key, or deleted if the key is nil.
+func (p TxPublisher) updatePending(topic string, uuid string, fn func(MessageKey, []byte) (MessageKey, error)) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+
+	subscriptions, err := p.registry.Subscriptions(topic)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve subscriptions: %w", err)
+	}
+
+	var found bool
+	for _, subscription := range subscriptions {
+		indexKey := GenerateIndexKey(subscription.IndexKeyPrefix, uuid)
+
+		key, value, err := p.getPending(indexKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		newKey, err := fn(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to update message: %w", err)
+		}
+
+		if newKey != nil {
+			err = p.tx.Set(indexKey, newKey)
+		} else {
+			err = p.tx.Delete(indexKey)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update index: %w", err)
+		}
+
+		found = true
+	}
+
+	if !found {
+		return ErrMessageNotFound
 	}
 
 	return nil
 }
 
+// getPending returns the message key and value for the specified index key
+// Messages that have been received are no longer pending, as receiving
+// a message updates its key.
+func (p TxPublisher) getPending(indexKey []byte) (MessageKey, []byte, error) {
+	item, err := p.tx.Get(indexKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	item, err = p.tx.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, value, nil
+}
+
+// subscriptionValue returns the value to be written for a subscription
+// If the storage mode is StorageShared then the message body is written once,
+// and a pointer to a new body reference is returned. Otherwise messages that
+// exceed the inline threshold are written to a body for each subscription.
+func (p TxPublisher) subscriptionValue(m *preparedMessage, s *Subscription) ([]byte, error) {
+	value, body := m.value, &m.body
+	if IsTopicPattern(s.Topic) {
+		value, body = m.patternValue, &m.patternBody
+	}
+
+	if p.config.Storage != StorageShared {
+		if p.config.InlineThreshold < 0 || len(value)-valueHeaderLen <= p.config.InlineThreshold {
+			return value, nil
+		}
+
+		// each subscription has a separate body
+		body = new([]byte)
+	}
+
+	header, data := decodeValue(value)
+
+	if *body == nil {
+		*body = p.generateBodyKey(s)
+
+		if err := p.tx.Set(*body, data); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := generateBodyRefKey(*body, m.refs)
+	m.refs++
+
+	if err := p.tx.Set(ref, nil); err != nil {
+		return nil, err
+	}
+
+	return encodePointer(header, ref), nil
+}
+
+// generateBodyKey returns a new body key using the subscription body key prefix
+func (p TxPublisher) generateBodyKey(s *Subscription) []byte {
+	if s.BodyKeyPrefix == nil {
+		return GenerateBodyKey(p.config.Prefix, watermill.NewULID())
+	}
+
+	return append(slices.Clip(s.BodyKeyPrefix), watermill.NewULID()...)
+}
+
+func (p TxPublisher) wrapError(topic string, msg string, err error) error {
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		return &TxnTooBigError{Topic: topic}
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
 func (p TxPublisher) Close() error {
 	return nil
 }
 
-func (p TxPublisher) marshalMessage(m *message.Message, now time.Time) ([]byte, error) {
+// prepareMessage starts the publish span and returns the message to be written
+// If patterned is true then the message is also marshaled with the topic metadata.
+func (p TxPublisher) prepareMessage(topic string, m *message.Message, now time.Time, patterned bool) (preparedMessage, trace.Span, error) {
+	dueAt, err := p.getDueAt(m, now)
+	if err != nil {
+		return preparedMessage{}, nil, fmt.Errorf("failed to parse delay: %w", err)
+	}
+
+	priority, err := getPriority(m)
+	if err != nil {
+		return preparedMessage{}, nil, fmt.Errorf("failed to parse priority: %w", err)
+	}
+
+	ctx, span := startPublishSpan(p.config.TracerProvider, m, topic, dueAt.Sub(now))
+	metadata := injectTraceContext(ctx, p.config.Propagator, m.Metadata)
+
+	value, err := p.marshalMessage(m, metadata, now, dueAt)
+	if err != nil {
+		return preparedMessage{}, span, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	var patternValue []byte
+	if patterned {
+		metadata[TopicKey] = topic
+
+		patternValue, err = p.marshalMessage(m, metadata, now, dueAt)
+		if err != nil {
+			return preparedMessage{}, span, fmt.Errorf("failed to marshal message: %w", err)
+		}
+	}
+
+	return preparedMessage{
+		uuid:         m.UUID,
+		metadata:     m.Metadata,
+		value:        value,
+		patternValue: patternValue,
+		dueAt:        dueAt,
+		priority:     priority,
+	}, span, nil
+}
+
+func (p TxPublisher) marshalMessage(m *message.Message, metadata message.Metadata, now, dueAt time.Time) ([]byte, error) {
 	persistedMessage := PersistedMessage{
 		UUID:     m.UUID,
-		Metadata: m.Metadata,
+		Metadata: metadata,
 		Payload:  m.Payload,
 		Created:  now,
 	}
@@ -94,7 +372,7 @@ func (p TxPublisher) marshalMessage(m *message.Message, now time.Time) ([]byte,
 		return nil, err
 	}
 
-	return value, nil
+	return encodeValue(valueHeader{dueAt: dueAt}, value), nil
 }
 
 func (p TxPublisher) getDueAt(m *message.Message, now time.Time) (time.Time, error) {
@@ -107,5 +385,10 @@ func (p TxPublisher) getDueAt(m *message.Message, now time.Time) (time.Time, err
 		return now, nil
 	}
 
-	return time.Parse(time.RFC3339, until)
+	dueAt, err := time.Parse(time.RFC3339Nano, until)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidDueTime, err)
+	}
+
+	return p.config.DueTimePolicy.apply(dueAt, now)
 }
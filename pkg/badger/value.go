@@ -0,0 +1,86 @@
+package badger
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// valueHeader represents the delivery state stored with each message value
+// The due time is the time the message was originally due, which is retained
+// when the message key is updated by a lease.
+type valueHeader struct {
+	attempt uint32
+	dueAt   time.Time
+}
+
+const (
+	valueMagic     = 0xba
+	valueVersion   = 1
+	valueHeaderLen = 14 // magic + version + attempt + due time
+)
+
+// encodeValue encodes the marshaled message with the value header
+func encodeValue(h valueHeader, data []byte) []byte {
+	encoded := make([]byte, valueHeaderLen+len(data))
+	encoded[0] = valueMagic
+	encoded[1] = valueVersion
+	binary.BigEndian.PutUint32(encoded[2:6], h.attempt)
+	binary.BigEndian.PutUint64(encoded[6:valueHeaderLen], uint64(h.dueAt.UnixNano()))
+	copy(encoded[valueHeaderLen:], data)
+
+	return encoded
+}
+
+// decodeValue returns the value header and marshaled message
+// Values are always written with a header for versioned message keys, and
+// values of unversioned keys are rewritten with a header by MigrateMessageKeys,
+// so marshaled messages are never mistaken for a header. Values without a valid
+// header are corrupt, and are returned as-is so that they are quarantined.
+func decodeValue(b []byte) (valueHeader, []byte) {
+	if len(b) < valueHeaderLen || b[0] != valueMagic || b[1] != valueVersion {
+		return valueHeader{}, b
+	}
+
+	return decodeValueHeader(b), b[valueHeaderLen:]
+}
+
+const pointerMagic = 0xbb
+
+// encodePointer encodes the shared body reference with the value header
+func encodePointer(h valueHeader, ref []byte) []byte {
+	encoded := encodeValue(h, ref)
+	encoded[0] = pointerMagic
+
+	return encoded
+}
+
+// decodePointer returns the value header and shared body reference
+// If the value is not a pointer then false is returned.
+func decodePointer(b []byte) (valueHeader, []byte, bool) {
+	if len(b) < valueHeaderLen || b[0] != pointerMagic || b[1] != valueVersion {
+		return valueHeader{}, nil, false
+	}
+
+	return decodeValueHeader(b), b[valueHeaderLen:], true
+}
+
+// updateValueDueAt returns a copy of the value or pointer with the specified due time
+// Values without a valid header are returned unchanged.
+func updateValueDueAt(b []byte, dueAt time.Time) []byte {
+	if len(b) < valueHeaderLen || (b[0] != valueMagic && b[0] != pointerMagic) || b[1] != valueVersion {
+		return b
+	}
+
+	encoded := make([]byte, len(b))
+	copy(encoded, b)
+	binary.BigEndian.PutUint64(encoded[6:valueHeaderLen], uint64(dueAt.UnixNano()))
+
+	return encoded
+}
+
+func decodeValueHeader(b []byte) valueHeader {
+	return valueHeader{
+		attempt: binary.BigEndian.Uint32(b[2:6]),
+		dueAt:   time.Unix(0, int64(binary.BigEndian.Uint64(b[6:valueHeaderLen]))).UTC(),
+	}
+}
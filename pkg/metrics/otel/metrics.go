@@ -0,0 +1,185 @@
+// Package otel provides an OpenTelemetry implementation of the badger.Metrics interface
+package otel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+type (
+	// Config represents metrics configuration
+	// An empty value is valid, using the global meter provider
+	Config struct {
+		MeterProvider metric.MeterProvider
+	}
+
+	// Metrics represents an OpenTelemetry implementation of the badger.Metrics interface
+	Metrics struct {
+		published       metric.Int64Counter
+		publishDuration metric.Float64Histogram
+		batchSize       metric.Int64Histogram
+		acked           metric.Int64Counter
+		nacked          metric.Int64Counter
+		redelivered     metric.Int64Counter
+		leaseExpired    metric.Int64Counter
+		handlerLatency  metric.Float64Histogram
+		queueDepth      metric.Int64Gauge
+		oldestAge       metric.Float64Gauge
+		gcRuns          metric.Int64Counter
+		gcRewrites      metric.Int64Counter
+		gcDuration      metric.Float64Histogram
+		lsmSize         metric.Int64Gauge
+		vlogSize        metric.Int64Gauge
+	}
+)
+
+const instrumentationName = "github.com/stevecallear/watermill-badger"
+
+// New returns new OpenTelemetry metrics
+func New(c Config) (*Metrics, error) {
+	c.setDefaults()
+
+	meter := c.MeterProvider.Meter(instrumentationName)
+	m := new(Metrics)
+
+	var err, ierr error
+	m.published, ierr = meter.Int64Counter("messaging.badger.published",
+		metric.WithDescription("The number of published messages."))
+	err = errors.Join(err, ierr)
+
+	m.publishDuration, ierr = meter.Float64Histogram("messaging.badger.publish.duration",
+		metric.WithDescription("The time taken to publish messages."), metric.WithUnit("s"))
+	err = errors.Join(err, ierr)
+
+	m.batchSize, ierr = meter.Int64Histogram("messaging.badger.received.batch_size",
+		metric.WithDescription("The number of messages in each received batch."))
+	err = errors.Join(err, ierr)
+
+	m.acked, ierr = meter.Int64Counter("messaging.badger.acked",
+		metric.WithDescription("The number of acked messages."))
+	err = errors.Join(err, ierr)
+
+	m.nacked, ierr = meter.Int64Counter("messaging.badger.nacked",
+		metric.WithDescription("The number of nacked messages."))
+	err = errors.Join(err, ierr)
+
+	m.redelivered, ierr = meter.Int64Counter("messaging.badger.redelivered",
+		metric.WithDescription("The number of messages received more than once."))
+	err = errors.Join(err, ierr)
+
+	m.leaseExpired, ierr = meter.Int64Counter("messaging.badger.lease.expired",
+		metric.WithDescription("The number of messages acked or nacked after the visibility timeout."))
+	err = errors.Join(err, ierr)
+
+	m.handlerLatency, ierr = meter.Float64Histogram("messaging.badger.handler.latency",
+		metric.WithDescription("The time between message publish and ack."), metric.WithUnit("s"))
+	err = errors.Join(err, ierr)
+
+	m.queueDepth, ierr = meter.Int64Gauge("messaging.badger.queue.depth",
+		metric.WithDescription("The number of messages in the subscription."))
+	err = errors.Join(err, ierr)
+
+	m.oldestAge, ierr = meter.Float64Gauge("messaging.badger.queue.oldest_age",
+		metric.WithDescription("The time since the oldest due message in the subscription was due."), metric.WithUnit("s"))
+	err = errors.Join(err, ierr)
+
+	m.gcRuns, ierr = meter.Int64Counter("messaging.badger.gc.runs",
+		metric.WithDescription("The number of value log garbage collection runs."))
+	err = errors.Join(err, ierr)
+
+	m.gcRewrites, ierr = meter.Int64Counter("messaging.badger.gc.rewrites",
+		metric.WithDescription("The number of value log files rewritten by garbage collection."))
+	err = errors.Join(err, ierr)
+
+	m.gcDuration, ierr = meter.Float64Histogram("messaging.badger.gc.duration",
+		metric.WithDescription("The time taken to collect value log garbage."), metric.WithUnit("s"))
+	err = errors.Join(err, ierr)
+
+	m.lsmSize, ierr = meter.Int64Gauge("messaging.badger.lsm.size",
+		metric.WithDescription("The size of the LSM tree after garbage collection."), metric.WithUnit("By"))
+	err = errors.Join(err, ierr)
+
+	m.vlogSize, ierr = meter.Int64Gauge("messaging.badger.vlog.size",
+		metric.WithDescription("The size of the value log after garbage collection."), metric.WithUnit("By"))
+	err = errors.Join(err, ierr)
+
+	return m, err
+}
+
+// MessagesPublished records published messages
+func (m *Metrics) MessagesPublished(topic string, count int, duration time.Duration) {
+	attrs := topicAttributes(topic)
+	m.published.Add(context.Background(), int64(count), attrs)
+	m.publishDuration.Record(context.Background(), duration.Seconds(), attrs)
+}
+
+// MessagesReceived records the received batch size
+func (m *Metrics) MessagesReceived(topic, subscription string, count int) {
+	m.batchSize.Record(context.Background(), int64(count), subscriptionAttributes(topic, subscription))
+}
+
+// MessageAcked records an acked message
+func (m *Metrics) MessageAcked(topic, subscription string) {
+	m.acked.Add(context.Background(), 1, subscriptionAttributes(topic, subscription))
+}
+
+// MessageNacked records a nacked message
+func (m *Metrics) MessageNacked(topic, subscription string) {
+	m.nacked.Add(context.Background(), 1, subscriptionAttributes(topic, subscription))
+}
+
+// MessageRedelivered records a redelivered message
+func (m *Metrics) MessageRedelivered(topic, subscription string) {
+	m.redelivered.Add(context.Background(), 1, subscriptionAttributes(topic, subscription))
+}
+
+// LeaseExpired records an expired lease
+func (m *Metrics) LeaseExpired(topic, subscription string) {
+	m.leaseExpired.Add(context.Background(), 1, subscriptionAttributes(topic, subscription))
+}
+
+// MessageHandled records the handler latency
+func (m *Metrics) MessageHandled(topic, subscription string, latency time.Duration) {
+	m.handlerLatency.Record(context.Background(), latency.Seconds(), subscriptionAttributes(topic, subscription))
+}
+
+// QueueStats records the subscription queue statistics
+func (m *Metrics) QueueStats(topic, subscription string, stats badger.QueueStats) {
+	attrs := subscriptionAttributes(topic, subscription)
+	m.queueDepth.Record(context.Background(), int64(stats.Depth), attrs)
+	m.oldestAge.Record(context.Background(), stats.OldestAge.Seconds(), attrs)
+}
+
+// ValueLogGC records the value log garbage collection statistics
+func (m *Metrics) ValueLogGC(stats badger.GCStats) {
+	ctx := context.Background()
+	m.gcRuns.Add(ctx, 1)
+	m.gcRewrites.Add(ctx, int64(stats.Rewrites))
+	m.gcDuration.Record(ctx, stats.Duration.Seconds())
+	m.lsmSize.Record(ctx, stats.LSMSize)
+	m.vlogSize.Record(ctx, stats.VLogSize)
+}
+
+func topicAttributes(topic string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String("messaging.destination.name", topic))
+}
+
+func subscriptionAttributes(topic, subscription string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.destination.subscription.name", subscription),
+	)
+}
+
+func (c *Config) setDefaults() {
+	if c.MeterProvider == nil {
+		c.MeterProvider = otel.GetMeterProvider()
+	}
+}
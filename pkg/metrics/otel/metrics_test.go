@@ -0,0 +1,82 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+	"github.com/stevecallear/watermill-badger/pkg/metrics/otel"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	sut, err := otel.New(otel.Config{MeterProvider: provider})
+	if err != nil {
+		t.Fatalf("got %v, expected nil", err)
+	}
+
+	sut.MessagesPublished("topic", 2, time.Millisecond)
+	sut.MessagesReceived("topic", "sub", 2)
+	sut.MessageAcked("topic", "sub")
+	sut.MessageNacked("topic", "sub")
+	sut.MessageRedelivered("topic", "sub")
+	sut.LeaseExpired("topic", "sub")
+	sut.MessageHandled("topic", "sub", time.Second)
+	sut.QueueStats("topic", "sub", badger.QueueStats{Depth: 3, OldestAge: 2 * time.Second})
+	sut.ValueLogGC(badger.GCStats{Rewrites: 2, Duration: time.Second, LSMSize: 4, VLogSize: 5})
+
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("got %v, expected nil", err)
+	}
+
+	act := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				act[m.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Gauge[int64]:
+				act[m.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Gauge[float64]:
+				act[m.Name] = data.DataPoints[0].Value
+			case metricdata.Histogram[int64]:
+				act[m.Name] = float64(data.DataPoints[0].Count)
+			case metricdata.Histogram[float64]:
+				act[m.Name] = float64(data.DataPoints[0].Count)
+			}
+		}
+	}
+
+	exp := map[string]float64{
+		"messaging.badger.published":           2,
+		"messaging.badger.publish.duration":    1,
+		"messaging.badger.received.batch_size": 1,
+		"messaging.badger.acked":               1,
+		"messaging.badger.nacked":              1,
+		"messaging.badger.redelivered":         1,
+		"messaging.badger.lease.expired":       1,
+		"messaging.badger.handler.latency":     1,
+		"messaging.badger.queue.depth":         3,
+		"messaging.badger.queue.oldest_age":    2,
+		"messaging.badger.gc.runs":             1,
+		"messaging.badger.gc.rewrites":         2,
+		"messaging.badger.gc.duration":         1,
+		"messaging.badger.lsm.size":            4,
+		"messaging.badger.vlog.size":           5,
+	}
+
+	for name, value := range exp {
+		t.Run("should record "+name, func(t *testing.T) {
+			if act[name] != value {
+				t.Errorf("got %v, expected %v", act[name], value)
+			}
+		})
+	}
+}
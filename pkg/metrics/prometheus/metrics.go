@@ -0,0 +1,218 @@
+// Package prometheus provides a Prometheus implementation of the badger.Metrics interface
+package prometheus
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+)
+
+type (
+	// Config represents metrics configuration
+	// An empty value is valid, using the default registerer
+	Config struct {
+		Namespace  string
+		Registerer prometheus.Registerer
+	}
+
+	// Metrics represents a Prometheus implementation of the badger.Metrics interface
+	Metrics struct {
+		published       *prometheus.CounterVec
+		publishDuration *prometheus.HistogramVec
+		batchSize       *prometheus.HistogramVec
+		acked           *prometheus.CounterVec
+		nacked          *prometheus.CounterVec
+		redelivered     *prometheus.CounterVec
+		leaseExpired    *prometheus.CounterVec
+		handlerLatency  *prometheus.HistogramVec
+		queueDepth      *prometheus.GaugeVec
+		oldestAge       *prometheus.GaugeVec
+		gcRuns          prometheus.Counter
+		gcRewrites      prometheus.Counter
+		gcDuration      prometheus.Histogram
+		lsmSize         prometheus.Gauge
+		vlogSize        prometheus.Gauge
+	}
+)
+
+var (
+	topicLabels        = []string{"topic"}
+	subscriptionLabels = []string{"topic", "subscription"}
+)
+
+// New returns new Prometheus metrics, registering all collectors
+func New(c Config) (*Metrics, error) {
+	c.setDefaults()
+
+	m := &Metrics{
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "published_messages_total",
+			Help:      "The number of published messages.",
+		}, topicLabels),
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: c.Namespace,
+			Name:      "publish_duration_seconds",
+			Help:      "The time taken to publish messages.",
+		}, topicLabels),
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: c.Namespace,
+			Name:      "received_batch_size",
+			Help:      "The number of messages in each received batch.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, subscriptionLabels),
+		acked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "acked_messages_total",
+			Help:      "The number of acked messages.",
+		}, subscriptionLabels),
+		nacked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "nacked_messages_total",
+			Help:      "The number of nacked messages.",
+		}, subscriptionLabels),
+		redelivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "redelivered_messages_total",
+			Help:      "The number of messages received more than once.",
+		}, subscriptionLabels),
+		leaseExpired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "expired_leases_total",
+			Help:      "The number of messages acked or nacked after the visibility timeout.",
+		}, subscriptionLabels),
+		handlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: c.Namespace,
+			Name:      "handler_latency_seconds",
+			Help:      "The time between message publish and ack.",
+		}, subscriptionLabels),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: c.Namespace,
+			Name:      "queue_depth",
+			Help:      "The number of messages in the subscription.",
+		}, subscriptionLabels),
+		oldestAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: c.Namespace,
+			Name:      "oldest_message_age_seconds",
+			Help:      "The time since the oldest due message in the subscription was due.",
+		}, subscriptionLabels),
+		gcRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "value_log_gc_runs_total",
+			Help:      "The number of value log garbage collection runs.",
+		}),
+		gcRewrites: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: c.Namespace,
+			Name:      "value_log_gc_rewrites_total",
+			Help:      "The number of value log files rewritten by garbage collection.",
+		}),
+		gcDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: c.Namespace,
+			Name:      "value_log_gc_duration_seconds",
+			Help:      "The time taken to collect value log garbage.",
+		}),
+		lsmSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: c.Namespace,
+			Name:      "lsm_size_bytes",
+			Help:      "The size of the LSM tree after garbage collection.",
+		}),
+		vlogSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: c.Namespace,
+			Name:      "value_log_size_bytes",
+			Help:      "The size of the value log after garbage collection.",
+		}),
+	}
+
+	var err error
+	for _, collector := range m.collectors() {
+		if rerr := c.Registerer.Register(collector); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+	}
+
+	return m, err
+}
+
+// MessagesPublished records published messages
+func (m *Metrics) MessagesPublished(topic string, count int, duration time.Duration) {
+	m.published.WithLabelValues(topic).Add(float64(count))
+	m.publishDuration.WithLabelValues(topic).Observe(duration.Seconds())
+}
+
+// MessagesReceived records the received batch size
+func (m *Metrics) MessagesReceived(topic, subscription string, count int) {
+	m.batchSize.WithLabelValues(topic, subscription).Observe(float64(count))
+}
+
+// MessageAcked records an acked message
+func (m *Metrics) MessageAcked(topic, subscription string) {
+	m.acked.WithLabelValues(topic, subscription).Inc()
+}
+
+// MessageNacked records a nacked message
+func (m *Metrics) MessageNacked(topic, subscription string) {
+	m.nacked.WithLabelValues(topic, subscription).Inc()
+}
+
+// MessageRedelivered records a redelivered message
+func (m *Metrics) MessageRedelivered(topic, subscription string) {
+	m.redelivered.WithLabelValues(topic, subscription).Inc()
+}
+
+// LeaseExpired records an expired lease
+func (m *Metrics) LeaseExpired(topic, subscription string) {
+	m.leaseExpired.WithLabelValues(topic, subscription).Inc()
+}
+
+// MessageHandled records the handler latency
+func (m *Metrics) MessageHandled(topic, subscription string, latency time.Duration) {
+	m.handlerLatency.WithLabelValues(topic, subscription).Observe(latency.Seconds())
+}
+
+// QueueStats records the subscription queue statistics
+func (m *Metrics) QueueStats(topic, subscription string, stats badger.QueueStats) {
+	m.queueDepth.WithLabelValues(topic, subscription).Set(float64(stats.Depth))
+	m.oldestAge.WithLabelValues(topic, subscription).Set(stats.OldestAge.Seconds())
+}
+
+// ValueLogGC records the value log garbage collection statistics
+func (m *Metrics) ValueLogGC(stats badger.GCStats) {
+	m.gcRuns.Inc()
+	m.gcRewrites.Add(float64(stats.Rewrites))
+	m.gcDuration.Observe(stats.Duration.Seconds())
+	m.lsmSize.Set(float64(stats.LSMSize))
+	m.vlogSize.Set(float64(stats.VLogSize))
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.published,
+		m.publishDuration,
+		m.batchSize,
+		m.acked,
+		m.nacked,
+		m.redelivered,
+		m.leaseExpired,
+		m.handlerLatency,
+		m.queueDepth,
+		m.oldestAge,
+		m.gcRuns,
+		m.gcRewrites,
+		m.gcDuration,
+		m.lsmSize,
+		m.vlogSize,
+	}
+}
+
+func (c *Config) setDefaults() {
+	if c.Namespace == "" {
+		c.Namespace = "watermill_badger"
+	}
+
+	if c.Registerer == nil {
+		c.Registerer = prometheus.DefaultRegisterer
+	}
+}
@@ -0,0 +1,117 @@
+package prometheus_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/stevecallear/watermill-badger/pkg/badger"
+	"github.com/stevecallear/watermill-badger/pkg/metrics/prometheus"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("should return an error if the collectors are already registered", func(t *testing.T) {
+		r := prom.NewRegistry()
+
+		_, err := prometheus.New(prometheus.Config{Registerer: r})
+		if err != nil {
+			t.Fatalf("got %v, expected nil", err)
+		}
+
+		_, err = prometheus.New(prometheus.Config{Registerer: r})
+		if err == nil {
+			t.Error("got nil, expected error")
+		}
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	r := prom.NewRegistry()
+
+	sut, err := prometheus.New(prometheus.Config{Registerer: r})
+	if err != nil {
+		t.Fatalf("got %v, expected nil", err)
+	}
+
+	sut.MessagesPublished("topic", 2, time.Millisecond)
+	sut.MessagesReceived("topic", "sub", 2)
+	sut.MessageAcked("topic", "sub")
+	sut.MessageNacked("topic", "sub")
+	sut.MessageRedelivered("topic", "sub")
+	sut.LeaseExpired("topic", "sub")
+	sut.MessageHandled("topic", "sub", time.Second)
+	sut.QueueStats("topic", "sub", badger.QueueStats{Depth: 3, OldestAge: 2 * time.Second})
+	sut.ValueLogGC(badger.GCStats{Rewrites: 2, Duration: time.Second, LSMSize: 4, VLogSize: 5})
+
+	t.Run("should record counters and gauges", func(t *testing.T) {
+		exp := `
+# HELP watermill_badger_published_messages_total The number of published messages.
+# TYPE watermill_badger_published_messages_total counter
+watermill_badger_published_messages_total{topic="topic"} 2
+# HELP watermill_badger_acked_messages_total The number of acked messages.
+# TYPE watermill_badger_acked_messages_total counter
+watermill_badger_acked_messages_total{subscription="sub",topic="topic"} 1
+# HELP watermill_badger_nacked_messages_total The number of nacked messages.
+# TYPE watermill_badger_nacked_messages_total counter
+watermill_badger_nacked_messages_total{subscription="sub",topic="topic"} 1
+# HELP watermill_badger_redelivered_messages_total The number of messages received more than once.
+# TYPE watermill_badger_redelivered_messages_total counter
+watermill_badger_redelivered_messages_total{subscription="sub",topic="topic"} 1
+# HELP watermill_badger_expired_leases_total The number of messages acked or nacked after the visibility timeout.
+# TYPE watermill_badger_expired_leases_total counter
+watermill_badger_expired_leases_total{subscription="sub",topic="topic"} 1
+# HELP watermill_badger_queue_depth The number of messages in the subscription.
+# TYPE watermill_badger_queue_depth gauge
+watermill_badger_queue_depth{subscription="sub",topic="topic"} 3
+# HELP watermill_badger_oldest_message_age_seconds The time since the oldest due message in the subscription was due.
+# TYPE watermill_badger_oldest_message_age_seconds gauge
+watermill_badger_oldest_message_age_seconds{subscription="sub",topic="topic"} 2
+# HELP watermill_badger_value_log_gc_runs_total The number of value log garbage collection runs.
+# TYPE watermill_badger_value_log_gc_runs_total counter
+watermill_badger_value_log_gc_runs_total 1
+# HELP watermill_badger_value_log_gc_rewrites_total The number of value log files rewritten by garbage collection.
+# TYPE watermill_badger_value_log_gc_rewrites_total counter
+watermill_badger_value_log_gc_rewrites_total 2
+# HELP watermill_badger_lsm_size_bytes The size of the LSM tree after garbage collection.
+# TYPE watermill_badger_lsm_size_bytes gauge
+watermill_badger_lsm_size_bytes 4
+# HELP watermill_badger_value_log_size_bytes The size of the value log after garbage collection.
+# TYPE watermill_badger_value_log_size_bytes gauge
+watermill_badger_value_log_size_bytes 5
+`
+		err := testutil.GatherAndCompare(r, strings.NewReader(exp),
+			"watermill_badger_published_messages_total",
+			"watermill_badger_acked_messages_total",
+			"watermill_badger_nacked_messages_total",
+			"watermill_badger_redelivered_messages_total",
+			"watermill_badger_expired_leases_total",
+			"watermill_badger_queue_depth",
+			"watermill_badger_oldest_message_age_seconds",
+			"watermill_badger_value_log_gc_runs_total",
+			"watermill_badger_value_log_gc_rewrites_total",
+			"watermill_badger_lsm_size_bytes",
+			"watermill_badger_value_log_size_bytes",
+		)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should record histograms", func(t *testing.T) {
+		count, err := testutil.GatherAndCount(r,
+			"watermill_badger_publish_duration_seconds",
+			"watermill_badger_received_batch_size",
+			"watermill_badger_handler_latency_seconds",
+			"watermill_badger_value_log_gc_duration_seconds",
+		)
+		if err != nil {
+			t.Fatalf("got %v, expected nil", err)
+		}
+		if count != 4 {
+			t.Errorf("got %d, expected 4", count)
+		}
+	})
+}